@@ -0,0 +1,153 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package coyotetest runs coyote yaml suites with `go test`,
+// so their failures show up in the standard test output and in IDE test runners.
+//
+//	func TestBrokers(t *testing.T) {
+//		coyotetest.Run(t, "testdata/brokers.yml")
+//	}
+package coyotetest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lensesio/coyote/runner"
+)
+
+// deadlineMargin is the time left between the timeout of an entry
+// and the deadline of the test, to report the failure before the test binary panics.
+const deadlineMargin = time.Second
+
+// Run loads the yaml "files" and runs each of their groups as a subtest of "t"
+// and each entry as a subtest of its group, named after the entry or its command.
+// An entry fails its subtest if its command fails or its assertions do not pass,
+// skipped groups and entries are skipped subtests. The setup entries of a group run first, its entries are skipped
+// if they fail, and its teardown entries run last, even after failures. A background entry passes its subtest once it is ready,
+// its outputs are tested once it is stopped and its failures fail the subtest of its group.
+// The `on_failure` of the groups and the `critical` entries skip the subtests that depend on a failed one.
+// The groups run after the groups they depend on and are skipped if one of these failed.
+// The groups and the entries run with `runner.Run`, the subtests only report their results, see `runner.GroupHook`.
+//
+// The timeouts of the entries are shortened to the deadline of the test, see the -timeout flag of `go test`.
+func Run(t *testing.T, files ...string) {
+	t.Helper()
+
+	groups, err := runner.Load(files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	RunGroups(t, groups)
+}
+
+// RunGroups is like `Run` but it runs groups that are already loaded.
+func RunGroups(t *testing.T, groups []runner.EntryGroup) {
+	t.Helper()
+
+	RunGroupsWithOptions(t, groups, runner.Options{})
+}
+
+// RunGroupsWithOptions is like `RunGroups` with the options of the run, i.e `FailFast`.
+// The logger defaults to one that discards the progress of the run.
+// A `GroupHook` of the options wraps the subtests of the groups, and the hook it passes wraps the runs of the entries.
+func RunGroupsWithOptions(t *testing.T, groups []runner.EntryGroup, opts runner.Options) {
+	t.Helper()
+
+	ctx := context.Background()
+	if deadline, ok := t.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-deadlineMargin))
+		defer cancel()
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = log.New(ioutil.Discard, "", 0)
+	}
+	// The hook of the caller wraps the subtests, the hook of its entries wraps the runs of the entries in their subtests.
+	groupHook := opts.GroupHook
+	opts.GroupHook = func(g runner.EntryGroup, run func(runner.EntryHook) runner.ResultGroup) {
+		if groupHook == nil {
+			subtest(t, g, run, nil)
+			return
+		}
+		groupHook(g, func(hook runner.EntryHook) runner.ResultGroup {
+			return subtest(t, g, run, hook)
+		})
+	}
+
+	// The failures are reported by the subtests, an error of the run is the deadline of the test.
+	if _, err := runner.Run(ctx, groups, opts); err != nil && ctx.Err() == nil {
+		t.Fatal(err)
+	}
+}
+
+// subtest runs the group "g" by its "run" as a subtest of "t", each of its entries as a subtest of the group
+// through the "hook" if it is not nil, and returns its results.
+func subtest(t *testing.T, g runner.EntryGroup, run func(runner.EntryHook) runner.ResultGroup, hook runner.EntryHook) runner.ResultGroup {
+	var result runner.ResultGroup
+	t.Run(g.Name, func(t *testing.T) {
+		result = run(func(name string, run func() runner.Result) {
+			t.Run(name, func(t *testing.T) {
+				var r runner.Result
+				if hook == nil {
+					r = run()
+				} else {
+					hook(name, func() runner.Result {
+						r = run()
+						return r
+					})
+				}
+				testResult(t, r)
+			})
+		})
+
+		// The background entries passed their subtests once ready, they fail their group once stopped.
+		for _, results := range [][]runner.Result{result.Setup, result.Results, result.Teardown} {
+			for _, r := range results {
+				if r.Test.Background && r.Status != "ok" {
+					t.Errorf("%s: %s", r.Name, describe(r))
+				}
+			}
+		}
+		if result.SkipReason != "" {
+			t.Skip(result.SkipReason)
+		}
+	})
+	return result
+}
+
+// testResult fails "t" if the "result" of its entry failed, or skips it if the entry did not run.
+func testResult(t *testing.T, result runner.Result) {
+	switch result.Status {
+	case "ok", "running":
+	case "skipped":
+		t.Skip(result.SkipReason)
+	case "not run":
+		t.Skip("not run, the deadline of the test is exceeded")
+	default:
+		t.Error(describe(result))
+	}
+}
+
+// describe returns the status, the exit and the outputs of a failed "result".
+func describe(result runner.Result) string {
+	return fmt.Sprintf("%s: %s\ncommand: %s\nstdout:\n%s\nstderr:\n%s", result.Status, result.Exit, result.Command,
+		strings.Join(result.Stdout, "\n"), strings.Join(result.Stderr, "\n"))
+}
@@ -0,0 +1,120 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coyotetest
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/lensesio/coyote/runner"
+)
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the echo command")
+	}
+
+	Run(t, "testdata/suite.yml")
+}
+
+// TestSuite runs the suite of the COYOTETEST_SUITE environment variable, in the test binary started by `TestRunFailures`.
+func TestSuite(t *testing.T) {
+	suite := os.Getenv("COYOTETEST_SUITE")
+	if suite == "" {
+		t.Skip("runs in the test binary started by TestRunFailures")
+	}
+
+	Run(t, suite)
+}
+
+func TestRunGroupsWithOptionsGroupHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the echo command")
+	}
+
+	groups, err := runner.Load("testdata/suite.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	opts := runner.Options{
+		GroupHook: func(g runner.EntryGroup, run func(runner.EntryHook) runner.ResultGroup) {
+			result := run(func(name string, run func() runner.Result) {
+				got = append(got, g.Name+"/"+name+": "+run().Status)
+			})
+			got = append(got, g.Name+": "+result.SkipReason)
+		},
+	}
+	RunGroupsWithOptions(t, groups, opts)
+
+	expected := []string{
+		"Greetings/greet: ok",
+		`Greetings/echo "bye %WHO%": ok`,
+		"Greetings/not ready: skipped",
+		"Greetings: ",
+		"Skipped/false: skipped",
+		"Skipped: skip: true",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected the hook to wrap:\n%s\n\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the echo and false commands")
+	}
+
+	// The failing subtests would fail this test, they run in another test binary instead.
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSuite$", "-test.v")
+	cmd.Env = append(os.Environ(), "COYOTETEST_SUITE=testdata/failures.yml")
+	out, err := cmd.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("expected the suite to fail but got error %v:\n%s", err, out)
+	}
+
+	var got []string
+	for _, m := range regexp.MustCompile(`--- (PASS|FAIL|SKIP): TestSuite/(\S+)`).FindAllStringSubmatch(string(out), -1) {
+		got = append(got, m[2]+": "+m[1])
+	}
+
+	expected := []string{
+		"Failing: FAIL",
+		"Failing/passes: PASS",
+		"Failing/fails: FAIL",
+		"Failing/runs_after_a_failure: PASS",
+		"Dependent: SKIP",
+		"Dependent/never: SKIP",
+		"Independent: PASS",
+		"Independent/runs: PASS",
+		"Aborting: FAIL",
+		"Aborting/setup:_prepare: PASS",
+		"Aborting/fails: FAIL",
+		"Aborting/skipped: SKIP",
+		"Aborting/teardown:_cleanup: PASS",
+		"Aborted: SKIP",
+		"Aborted/skipped: SKIP",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected the subtests:\n%s\n\nbut got:\n%s\n\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"), out)
+	}
+	if !strings.Contains(string(out), "dependency failed: group 'Failing'") {
+		t.Fatalf("expected the dependent group to be skipped because of its dependency:\n%s", out)
+	}
+}
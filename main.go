@@ -12,55 +12,58 @@
 // limitations under the License.
 
 // Please remember that when an error occurs in the code (err != nil),
-// Coyote should exit with code 255. Exit codes 1-254 are reserved for the tests.
+// Coyote should exit with code 255. Exit code 254 is reserved for interrupted runs
+// and exit codes 1-253 for the tests.
 
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	shellwords "github.com/mattn/go-shellwords"
+	"github.com/lensesio/coyote/runner"
 )
 
 //go:generate go run template-generate/include_templates.go
 //go:generate go run version-generate/main.go
 
-const DEFAULT_TITLE = "Coyote Tests"
-
-var (
-	configFilesArray configFilesArrayFlag // This is set via flag.Var, so look into the init() function
-	defaultTimeout   = flag.Duration("timeout", 5*time.Minute, "default timeout for commands (e.g 2h45m, 60s, 300ms)")
-	title            = flag.String("title", DEFAULT_TITLE, "title to use for report")
-	outputFile       = flag.String("out", "coyote.html", "filename to save the results under, if exists it will be overwritten")
-	outputJsonFile   = flag.String("json-out", "", "filename to save the results JSON array under, if exitst it will be overwritten, if empty, will not be written")
-	version          = flag.Bool("version", false, "print coyote version")
-	customTemplate   = flag.String("template", "", "override internal golang template with this")
-	mergeResults     = flag.Bool("merge-results", false, "merge all trailing json results into one")
-	testGroups       = flag.String("run", ".*", "run tests against a particular set of entries by group name (regex). Works in converse of the inline 'skip' YAML option")
-)
-
-var (
-	logger            *log.Logger
-	uniqStrings       = make(map[string]string)
-	uniqRegexp        = regexp.MustCompile("%UNIQUE_[0-9A-Za-z_-]+%")
-	t                 *template.Template
-	acceptableVarName = regexp.MustCompile("^[a-zA-Z0-9_]+$")
-	globalVars        = make(map[string]string)
-)
+// exitInterrupted is the exit code when the run was interrupted by SIGINT or SIGTERM.
+const exitInterrupted = 254
+
+// config holds the command line flags.
+type config struct {
+	configFiles    configFilesArrayFlag
+	defaultTimeout time.Duration
+	title          string
+	outputFile     string
+	outputJsonFile string
+	outputJUnit    string
+	version        bool
+	customTemplate string
+	selfContained  bool
+	mergeResults   bool
+	testGroups     string
+	dryRun         bool
+	dryRunFormat   string
+	parallel       int
+	maxOutput      runner.ByteSize
+	artifactsDir   string
+	failFast       bool
+	validateOnly   bool // set by the validate subcommand.
+	args           []string
+}
 
 type configFilesArrayFlag []string
 
@@ -93,472 +96,253 @@ func (i *configFilesArrayFlag) Set(value string) error {
 	return nil
 }
 
-func init() {
-	logger = log.New(os.Stderr, "", log.Ldate|log.Ltime)
-
-	flag.Var(&configFilesArray, "c", "configuration file(s), may be set more than once (default \"coyote.yml\")")
-	flag.Parse()
-	if len(configFilesArray) == 0 {
-		configFilesArray = append(configFilesArray, "coyote.yml")
+// parseFlags parses the command line arguments "args", without the program name.
+func parseFlags(args []string) *config {
+	c := new(config)
+	// `coyote validate -c ...` only checks the configuration files.
+	if len(args) > 0 && args[0] == "validate" {
+		c.validateOnly = true
+		args = args[1:]
 	}
 
-	if *defaultTimeout == 0 {
-		*defaultTimeout = time.Duration(365 * 24 * time.Hour)
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flags.Var(&c.configFiles, "c", "configuration file(s), may be set more than once (default \"coyote.yml\")")
+	flags.DurationVar(&c.defaultTimeout, "timeout", 5*time.Minute, "default timeout for commands (e.g 2h45m, 60s, 300ms)")
+	flags.StringVar(&c.title, "title", runner.DefaultTitle, "title to use for report")
+	flags.StringVar(&c.outputFile, "out", "coyote.html", "filename to save the results under, if exists it will be overwritten")
+	flags.StringVar(&c.outputJsonFile, "json-out", "", "filename to save the results JSON array under, if exitst it will be overwritten, if empty, will not be written")
+	flags.StringVar(&c.outputJUnit, "junit-out", "", "filename to save the results as JUnit XML under, if exists it will be overwritten, if empty, will not be written")
+	flags.BoolVar(&c.version, "version", false, "print coyote version")
+	flags.StringVar(&c.customTemplate, "template", "", "override internal golang template with this")
+	flags.BoolVar(&c.selfContained, "self-contained", true, "include the scripts and stylesheets of the report inside it, so it opens from disk without a web server")
+	flags.BoolVar(&c.mergeResults, "merge-results", false, "merge all trailing json results into one")
+	flags.StringVar(&c.testGroups, "run", ".*", "run tests against a particular set of entries by group name (regex). Works in converse of the inline 'skip' YAML option")
+	flags.BoolVar(&c.dryRun, "dry-run", false, "print the commands that would run, with their variables replaced, and exit without running them")
+	flags.StringVar(&c.dryRunFormat, "dry-run-format", "text", "format of the -dry-run output, text or json")
+	flags.IntVar(&c.parallel, "parallel", 1, "maximum number of groups marked with 'parallel: true' to run concurrently")
+	flags.Var(&c.maxOutput, "max-output", "size of the stdout and stderr of a command to keep in the report (e.g 64KB, 1MB), only the head and the tail of larger outputs are kept, 0 keeps them whole")
+	flags.StringVar(&c.artifactsDir, "artifacts", "", "directory to save the whole outputs of the commands under, the report links to them, if empty, will not be written")
+	flags.BoolVar(&c.failFast, "fail-fast", false, "abort the run on the first failure and skip the rest, the groups with an 'on_failure' policy keep theirs")
+	flags.Parse(args)
+
+	if len(c.configFiles) == 0 {
+		c.configFiles = append(c.configFiles, "coyote.yml")
+	}
+	if c.defaultTimeout == 0 {
+		c.defaultTimeout = -1 // no timeout.
 	}
+	c.args = flags.Args()
+	return c
+}
 
-	var err error
-	var templateData = make([]byte, 0)
-	if len(*customTemplate) == 0 {
-		t, err = template.New("").Delims("<{=(", ")=}>").Parse(mainTemplate)
-	} else {
-		templateData, err = ioutil.ReadFile(*customTemplate)
-		if err == nil {
-			t, err = template.New("").Delims("<{=(", ")=}>").Parse(string(templateData))
+func main() {
+	logger := log.New(os.Stderr, "", log.Ldate|log.Ltime)
+	os.Exit(run(parseFlags(os.Args[1:]), logger))
+}
+
+// run runs coyote as configured by "c" and returns its exit code.
+func run(c *config, logger *log.Logger) int {
+	var templateText string
+	if c.customTemplate != "" {
+		b, err := ioutil.ReadFile(c.customTemplate)
+		if err != nil {
+			logger.Printf("Error while trying to load template: %s\n", err)
+			return 255
 		}
+		templateText = string(b)
 	}
+	t, err := runner.NewTemplate(templateText)
 	if err != nil {
 		logger.Printf("Error while trying to load template: %s\n", err)
-		os.Exit(255)
+		return 255
 	}
-}
 
-func main() {
-	if *version == true {
+	if c.version {
 		fmt.Printf("This is Landoop's Coyote %s.\n", vgVersion)
-		os.Exit(0)
+		return 0
 	}
 
-	if *mergeResults == true {
-		if len(flag.Args()) == 0 {
+	if c.mergeResults {
+		if len(c.args) == 0 {
 			logger.Printf("Requested to merge results, but no results were passed.")
-			os.Exit(255)
+			return 255
 		}
-		err := doMergeResults()
-		if err != nil {
-			log.Println(err)
-			os.Exit(255)
+		if err := doMergeResults(c, t, logger); err != nil {
+			logger.Println(err)
+			return 255
 		}
-		os.Exit(0)
+		return 0
 	}
 
-	logger.Printf("Starting coyote-tester\n")
-
-	// Set the available loaders to load EntryGroups from.
-	var loaders = []ContextLoader{
-		// from yaml file(s) configuration.
-		FileContextLoader(configFilesArray),
+	if c.validateOnly {
+		return doValidate(c, logger)
 	}
 
-	// Load the set of `EntryGroup` based on the available `EntryLoader`s.
-	var entriesGroups []EntryGroup
+	logger.Printf("Starting coyote-tester\n")
 
-	// we load all of them.
-	for _, loader := range loaders {
-		if err := loader.Load(&entriesGroups); err != nil {
-			// exit on first error.
-			logger.Fatal(err)
-		}
+	entriesGroups, err := runner.Load(c.configFiles...)
+	if err != nil {
+		logger.Println(err)
+		return 255
 	}
 
-	// keep only the user-defined "testGroups", if value not changed don't waste time here.
-	if q := *testGroups; q != ".*" {
-		testGroupsRegexp := regexp.MustCompile(q)
-
-		for i, v := range entriesGroups {
-			if !testGroupsRegexp.MatchString(v.Name) {
-				logger.Printf("Skipping processing group: [ %s ]\n", v.Name)
-				entriesGroups = append(entriesGroups[:i], entriesGroups[i+1:]...)
-			}
-		}
+	opts := runner.Options{
+		Title:          c.title,
+		DefaultTimeout: c.defaultTimeout,
+		Parallel:       c.parallel,
+		MaxOutput:      c.maxOutput,
+		ArtifactsDir:   c.artifactsDir,
+		FailFast:       c.failFast,
+		Logger:         logger,
 	}
 
-	var resultsGroups []ResultGroup
-	var passed = 0
-	var errors = 0
-	var totalTime = 0.0
-
-	// Search for Coyote Groups which Contain Global Configuration
-	for _, v := range entriesGroups {
-		// Reserved name coyote is used to set the title and global vars
-		if v.Name == "coyote" {
-			if v.Title != "" {
-				*title = v.Title
-			}
-			if len(v.Vars) != 0 {
-				var err error
-				globalVars, err = checkVarNames(v.Vars)
-				if err != nil {
-					log.Fatalln(err)
-				}
-			}
+	// skip all but the user-defined "testGroups", if value not changed don't waste time here.
+	if q := c.testGroups; q != ".*" {
+		expr, err := regexp.Compile(q)
+		if err != nil {
+			logger.Println(err)
+			return 255
 		}
+		opts.Filter = expr
 	}
 
-	// For groups in configuration
-	for _, v := range entriesGroups {
-		var results []Result
-		var resultGroup = ResultGroup{
-			Name:      v.Name,
-			Type:      v.Type,
-			Results:   results,
-			Passed:    0,
-			Errors:    0,
-			Total:     0,
-			TotalTime: 0.0,
-		}
-
-		// Reserved name coyote is used to set the title (and maybe other global vars in the future).
-		if v.Name == "coyote" {
-			continue
+	// Print the commands that would run and exit.
+	if c.dryRun {
+		plan, err := runner.Plan(entriesGroups, opts)
+		if err == nil {
+			err = runner.WritePlan(os.Stdout, plan, c.dryRunFormat)
 		}
-
-		// Check for Local Variables
-		localVars, err := checkVarNames(v.Vars)
 		if err != nil {
-			log.Fatalln(err)
-		}
-		// Replace any variables in title
-		v.Title = replaceVars(v.Title, localVars, globalVars)
-		// Skip test if asked
-		if strings.ToLower(v.Skip) == "true" {
-			logger.Printf("Skipping processing group: [ %s ]\n", v.Name)
-			continue
-		}
-		// Don't skip test if asked
-		if len(v.NoSkip) > 0 && strings.ToLower(v.NoSkip) != "true" {
-			logger.Printf("Skipping processing group: [ %s ]\n", v.Name)
-			continue
+			logger.Println(err)
+			return 255
 		}
+		return 0
+	}
 
-		logger.Printf("Starting processing group: [ %s ]\n", v.Name)
-		// For entries in group
-		for _, v := range v.Entries {
-			// Skip command if asked
-			if strings.ToLower(v.Skip) == "true" {
-				continue
-			}
-			// Don't skip command if asked
-			if len(v.NoSkip) > 0 && strings.ToLower(v.NoSkip) != "true" {
-				continue
-			}
-
-			// If timeout is missing, set the default. If it is <0, set infinite.
-			if v.Timeout == 0 {
-				v.Timeout = *defaultTimeout
-			} else if v.Timeout < 0 {
-				v.Timeout = time.Duration(365 * 24 * time.Hour)
-			}
-
-			v.MapVars(localVars, globalVars)
-			args, err := shellwords.Parse(v.Command)
-
-			if err != nil {
-				logger.Printf("Error when parsing command [ %s ] for [ %s ]\n", v.Command, v.Name)
-			}
-
-			// TODO
-			// if (!execute)
-			//   cmd := exec.Command("echo", args[0:]...)
-			// else
-			//   ...
-
-			if v.SleepBefore > 0 {
-				if !v.NoLog {
-					logger.Printf("Wait for %d seconds before run the test '%s'\n", int(v.SleepBefore.Seconds()), v.Name)
-				}
-				time.Sleep(v.SleepBefore)
-			}
-
-			var cmd *exec.Cmd
-			if len(args) == 0 { // Empty command?
-				logger.Printf("Entry %s is missing the command field. Aborting.\n", v.Name)
-				os.Exit(255)
-			} else {
-				cmd = exec.Command(args[0], args[1:]...)
-			}
-
-			if len(v.WorkDir) > 0 {
-				cmd.Dir = v.WorkDir
-			}
-			if len(v.Stdin) > 0 {
-				cmd.Stdin = strings.NewReader(v.Stdin)
-			}
-			cmd.Env = os.Environ()
-			if len(v.EnvVars) > 0 {
-				for _, v := range v.EnvVars {
-					cmd.Env = append(cmd.Env, v)
-				}
-			}
-			cmdOut := &bytes.Buffer{}
-			cmdErr := &bytes.Buffer{}
-			cmd.Stdout = cmdOut
-			cmd.Stderr = cmdErr
-
-			start := time.Now()
-			timer := time.AfterFunc(v.Timeout, func() {
-				cmd.Process.Kill()
-			})
-			//out, err := cmd.CombinedOutput()
-			err = cmd.Run()
-			timerLive := timer.Stop() // If command already exited, the timer is still live.
-			elapsed := time.Since(start)
-
-			stdout := string(cmdOut.Bytes())
-			stderr := string(cmdErr.Bytes())
-
-			// Perform a textTest on outputs.
-			_, textErr := v.Test(stdout, stderr)
-
-			if err != nil && timerLive && !v.IgnoreExitCode && textErr != nil {
-				logger.Printf("Error, command '%s', test '%s'. Error: %s, Stderr: %s\n", v.Command, v.Name, err.Error(), strconv.Quote(stderr))
-			} else if err != nil && !timerLive {
-				logger.Printf("Timeout, command '%s', test '%s'. Error: %s, Stderr: %s\n", v.Command, v.Name, err.Error(), strconv.Quote(stderr))
-			} else if textErr != nil {
-				logger.Printf("Output Error, command '%s', test '%s'. Error: %s, Stderr: %s\n", v.Command, v.Name, textErr.Error(), strconv.Quote(stdout))
-			} else {
-				logger.Printf("Success, command '%s', test '%s'. Stdout: %s\n", v.Command, v.Name, strconv.Quote(stdout))
-			}
-
-			if v.NoLog == false {
-				var t = Result{Name: v.Name, Command: v.Command, Stdout: strings.Split(stdout, "\n"), Stderr: strings.Split(stderr, "\n")}
-
-				if (err == nil || v.IgnoreExitCode) && textErr == nil {
-					t.Status = "ok"
-					if err != nil { // Here we have ignore_exit_code
-						t.Exit = "(ignore) " + strings.Replace(err.Error(), "exit status ", "", 1)
-					} else { // Here we exited normally
-						t.Exit = "0"
-					}
-					resultGroup.Passed++
-					//succesful++
-				} else {
-					t.Status = "error"
-					if err != nil && !v.IgnoreExitCode {
-						t.Exit = strings.Replace(err.Error(), "exit status ", "", 1)
-					} else {
-						t.Exit = "text"
-						t.Stderr = append(t.Stderr, strings.Split(textErr.Error(), "\n")...)
-					}
-					resultGroup.Errors++
-					//errors++
-					if !timerLive {
-						t.Status = "timeout"
-						t.Exit = "(timeout) " + t.Exit
-					}
-				}
-				t.Time = elapsed.Seconds()
-				// Clean Recursively Empty Top Lines from Output
-				t.Stdout = recurseClean(t.Stdout)
-				t.Stderr = recurseClean(t.Stderr)
-
-				t.Test = v
-				resultGroup.Results = append(resultGroup.Results, t)
-				resultGroup.TotalTime += t.Time
-			}
-
-			if v.SleepAfter > 0 {
-				if !v.NoLog {
-					logger.Printf("Wait for %d seconds after the test '%s' ran\n", int(v.SleepAfter.Seconds()), v.Name)
-				}
-				time.Sleep(v.SleepAfter)
-			}
-		}
-		resultGroup.Total = resultGroup.Passed + resultGroup.Errors
-		passed += resultGroup.Passed
-		errors += resultGroup.Errors
-		totalTime += resultGroup.TotalTime
-		resultsGroups = append(resultsGroups, resultGroup)
+	// On SIGINT or SIGTERM terminate the running command and write the results so far,
+	// a second signal stops coyote right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop() // restore the default behavior of the signals.
+	}()
+
+	data, err := runner.Run(ctx, entriesGroups, opts)
+	if err != nil && !data.Interrupted {
+		logger.Println(err)
+		return 255
 	}
+	stop()
 
-	data := ExportData{
-		resultsGroups,
-		errors,
-		passed,
-		errors + passed,
-		totalTime,
-		time.Now().UTC().Format("2006 Jan 02, Mon, 15:04 MST"),
-		*title,
+	if err := writeResults(c, t, data, logger); err != nil {
+		logger.Println(err)
+		return 255
 	}
 
-	if err := writeResults(data); err != nil {
-		log.Println(err)
-		os.Exit(255)
+	if data.Interrupted {
+		logger.Println("interrupted, the results are partial")
+		return exitInterrupted
 	}
 
+	errors := data.Errors + data.FixtureErrors
 	if errors == 0 {
 		logger.Println("no errors")
-	} else {
-		logger.Printf("errors were made: %d\n", errors)
-		if errors > 254 {
-			errors = 254
-		}
-		// If we had 253 or less errors, the error code indicates the number of errors.
-		// If we had 254 or more errors, the error code is 254.
-		os.Exit(errors)
+		return 0
 	}
-}
 
-// recurseClean cleans a []string from one or more empty entries at the start of the array.
-func recurseClean(t []string) []string {
-	if len(t) > 0 {
-		if len(t[0]) == 0 {
-			return recurseClean(t[1:])
-		}
+	logger.Printf("errors were made: %d\n", errors)
+	if errors > 253 {
+		errors = 253
 	}
-	return t
+	// If we had 252 or less errors, the error code indicates the number of errors.
+	// If we had 253 or more errors, the error code is 253.
+	return errors
 }
 
-// replaces instances of %UNIQUE% with a unique string based on current microsecond.
-func replaceUnique(s string) (result string) {
-	var contain = true
-	result = s
-	for {
-		switch contain {
-		case true:
-			if strings.Contains(result, "%UNIQUE%") { // Single use unique var
-				t := time.Now().UnixNano()
-				t = t / 1e6 // Keep millisecond
-				time.Sleep(time.Millisecond)
-				uniqueText := fmt.Sprintf("%d", t)
-				result = strings.Replace(result, "%UNIQUE%", uniqueText, 1)
-			} else if uniqRegexp.MatchString(result) { // Multi use unique var
-				stringsToReplace := uniqRegexp.FindAllString(result, -1)
-				assignMultiUseUniques(stringsToReplace)
-				for _, v := range stringsToReplace { // This may run more times than needed but it doesn't affect run times.
-					result = strings.Replace(result, v, uniqStrings[v], -1)
-				}
-			} else {
-				contain = false
-			}
-		case false:
-			return
-		}
-	}
-}
-
-func assignMultiUseUniques(matches []string) {
-	for _, v := range matches {
-		if _, exists := uniqStrings[v]; !exists {
-			t := time.Now().UnixNano()
-			t = t / 1e6 // Keep millisecond
-			time.Sleep(time.Millisecond)
-			uniqueText := fmt.Sprintf("%d", t)
-			uniqStrings[v] = uniqueText
-		}
-	}
-}
+// doValidate is called by the validate subcommand, it prints the issues
+// of the configuration files and returns the exit code.
+func doValidate(c *config, logger *log.Logger) int {
+	issues := runner.Validate(c.configFiles)
 
-// checkVarNames verifies that variable names are within acceptable criteria
-// and returns a new map where keys are enclosed within ampersands
-// so we can check for %VARNAME% entries.
-func checkVarNames(vars map[string]string) (map[string]string, error) {
-	r := make(map[string]string)
-	for k, v := range vars {
-		test := acceptableVarName.MatchString(k)
-		if test != true {
-			return r, errors.New("Variable name '" + k + "' contains illegal characters. Only alphanumerics and underscore are permitted for var names.")
-		}
-		test = uniqRegexp.MatchString("%" + k + "%")
-		if test == true {
-			return r, errors.New("Variable name '" + k + "' matches UNIQUE keyword for autogenerated values.")
-		}
-		if strings.Compare(k, "UNIQUE") == 0 {
-			return r, errors.New("Variable name 'UNIQUE' is reserved.")
+	var errors, warnings int
+	for _, issue := range issues {
+		fmt.Println(issue)
+		if issue.Warning {
+			warnings++
+		} else {
+			errors++
 		}
-		r["%"+k+"%"] = v
 	}
-	return r, nil
-}
 
-// replaceVars searches and replaces local and global variables in a string
-// localVars have precedence over globalVars
-func replaceVars(text string, localVars map[string]string, globalVars map[string]string) string {
-	for k, v := range localVars {
-		text = strings.Replace(text, k, v, -1)
-	}
-	for k, v := range globalVars {
-		text = strings.Replace(text, k, v, -1)
+	logger.Printf("Validated %d file(s): %d error(s), %d warning(s)\n", len(c.configFiles), errors, warnings)
+	if errors > 0 {
+		return 255
 	}
-	return text
+	return 0
 }
 
 // doMergeResults is called when we are asked to take old results
 // in json format and merge them and it does exactly that
-func doMergeResults() error {
-	inputFiles := flag.Args()
-	var inputData []ExportData
-	for _, v := range inputFiles {
-		fh, err := os.Open(v)
+func doMergeResults(c *config, t *template.Template, logger *log.Logger) error {
+	var inputData []runner.ExportData
+	for _, v := range c.args {
+		b, err := ioutil.ReadFile(v)
 		if err != nil {
 			return err
 		}
-		defer fh.Close()
-		b, _ := ioutil.ReadAll(fh)
-		var ed ExportData
+		var ed runner.ExportData
 		json.Unmarshal(b, &ed)
 		inputData = append(inputData, ed)
 	}
-	var outData ExportData
-	for k, v := range inputData {
-		outData.Results = append(outData.Results, v.Results...)
-		outData.Errors += v.Errors
-		outData.Successful += v.Successful
-		outData.TotalTests += v.TotalTests
-		outData.TotalTime += v.TotalTime
-		if k == 0 {
-			if *title == DEFAULT_TITLE {
-				outData.Title = v.Title
-			} else {
-				outData.Title = *title
-			}
-			outData.Date = v.Date
-		}
+
+	outData := runner.MergeResults(inputData...)
+	if c.title != runner.DefaultTitle {
+		outData.Title = c.title
 	}
 
-	err := writeResults(outData)
-	return err
+	return writeResults(c, t, outData, logger)
 }
 
 // writeResults create the htlm report file and optionally (if asked)
-// a json output file
-func writeResults(data ExportData) error {
-	f, err := os.Create(*outputFile)
+// a json and a JUnit XML output file
+func writeResults(c *config, t *template.Template, data runner.ExportData, logger *log.Logger) error {
+	f, err := os.Create(c.outputFile)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	h := &bytes.Buffer{}
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return errors.New("Coyote error when creating json.")
-	}
-
 	// Write json file if asked. We don't return error if this fails.
-	if *outputJsonFile != "" {
-		fj, err := os.Create(*outputJsonFile)
-		defer fj.Close()
+	if c.outputJsonFile != "" {
+		fj, err := os.Create(c.outputJsonFile)
 		if err != nil {
 			logger.Println(err)
 		} else {
-			fj.Write(jsonData)
+			if err = runner.WriteJSON(fj, data); err != nil {
+				logger.Println(err)
+			}
+			fj.Close()
 		}
 	}
 
-	templateVars := struct {
-		Data    template.JS
-		Version template.HTML
-	}{
-		template.JS(jsonData),
-		template.HTML("<!-- Generated by Coyote " + vgVersion + ". -->"),
+	// Write JUnit XML file if asked. We don't return error if this fails.
+	if c.outputJUnit != "" {
+		fx, err := os.Create(c.outputJUnit)
+		if err != nil {
+			logger.Println(err)
+		} else {
+			if err = runner.WriteJUnit(fx, data); err != nil {
+				logger.Println(err)
+			}
+			fx.Close()
+		}
 	}
 
-	// err = t.ExecuteTemplate(h, "template.html", data)
-	err = t.Execute(h, templateVars)
-	if err != nil {
-		return err
-	}
-	f.Write(h.Bytes())
-	return nil
+	return runner.WriteHTML(f, data, runner.ReportOptions{
+		Template:      t,
+		SelfContained: c.selfContained,
+		Generator:     "Coyote " + vgVersion,
+		Logger:        logger,
+	})
 }
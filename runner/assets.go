@@ -0,0 +1,90 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// assetsFS holds the scripts and stylesheets of the report, the file of an asset is its url
+// inside the assets directory, i.e `assets/ajax.googleapis.com/ajax/libs/angularjs/1.5.5/angular.min.js`.
+// They are downloaded by `go generate`, see template-generate/include_templates.go.
+//
+//go:embed assets
+var assetsFS embed.FS
+
+var (
+	scriptAssetRegexp     = regexp.MustCompile(`<script([^>]*) src="(//[^"]+)"([^>]*)></script>`)
+	stylesheetAssetRegexp = regexp.MustCompile(`<link rel="stylesheet" href="(//[^"]+)"\s*/?>`)
+)
+
+// templateAssets returns the contents of the scripts and stylesheets of the `assetsFS`, by their url.
+func templateAssets() map[string]string {
+	assets := make(map[string]string)
+	fs.WalkDir(assetsFS, "assets", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := path.Ext(file); ext != ".js" && ext != ".css" {
+			return nil
+		}
+
+		b, err := assetsFS.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		assets["/"+strings.TrimPrefix(file, "assets")] = string(b)
+		return nil
+	})
+	return assets
+}
+
+// inlineAssets replaces the scripts and stylesheets of the rendered "report" with their contents,
+// taken from "assets" by their url, so the report opens from disk without network access.
+//
+// Assets that are not available keep their tags but the protocol-relative urls
+// are turned to https ones, which browsers can load from a `file://` page too.
+// The urls of those assets are returned.
+func inlineAssets(report string, assets map[string]string) (string, []string) {
+	var missing []string
+
+	report = scriptAssetRegexp.ReplaceAllStringFunc(report, func(tag string) string {
+		m := scriptAssetRegexp.FindStringSubmatch(tag)
+		contents, ok := assets[m[2]]
+		if !ok {
+			missing = append(missing, m[2])
+			return "<script" + m[1] + ` src="https:` + m[2] + `"` + m[3] + "></script>"
+		}
+
+		// a "</script" inside the contents would end the inline script early.
+		return "<script>" + strings.Replace(contents, "</script", `<\/script`, -1) + "</script>"
+	})
+
+	report = stylesheetAssetRegexp.ReplaceAllStringFunc(report, func(tag string) string {
+		url := stylesheetAssetRegexp.FindStringSubmatch(tag)[1]
+		contents, ok := assets[url]
+		if !ok {
+			missing = append(missing, url)
+			return `<link rel="stylesheet" href="https:` + url + `">`
+		}
+
+		return "<style>" + strings.Replace(contents, "</style", `<\/style`, -1) + "</style>"
+	})
+
+	return report, missing
+}
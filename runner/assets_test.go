@@ -0,0 +1,87 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestInlineAssets(t *testing.T) {
+	report := `<head>
+<link rel="stylesheet" href="//cdn.example.com/style.css">
+<script src="//cdn.example.com/app.js"></script>
+<script src="//cdn.example.com/missing.js" type="text/javascript"></script>
+<link rel="stylesheet" href="//cdn.example.com/missing.css">
+</head>`
+
+	assets := map[string]string{
+		"//cdn.example.com/style.css": "body { color: red; }",
+		"//cdn.example.com/app.js":    `var s = "</script>";`,
+	}
+
+	got, missing := inlineAssets(report, assets)
+
+	expected := []string{
+		"<style>body { color: red; }</style>",
+		`<script>var s = "<\/script>";</script>`,
+		`<script src="https://cdn.example.com/missing.js" type="text/javascript"></script>`,
+		`<link rel="stylesheet" href="https://cdn.example.com/missing.css">`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(got, e) {
+			t.Fatalf("expected report to contain '%s' but got:\n%s", e, got)
+		}
+	}
+
+	if expected := []string{"//cdn.example.com/missing.js", "//cdn.example.com/missing.css"}; !reflect.DeepEqual(missing, expected) {
+		t.Fatalf("expected missing assets %v but got %v", expected, missing)
+	}
+}
+
+func TestWriteHTMLSelfContained(t *testing.T) {
+	// every asset of the internal template should be recognized.
+	_, urls := inlineAssets(mainTemplate, nil)
+	if len(urls) != 10 {
+		t.Fatalf("expected the 10 assets of the template but found %d: %v", len(urls), urls)
+	}
+	// These scripts load more resources when the report opens, inlining them is not enough.
+	for _, host := range []string{"use.fontawesome.com", "buttons.github.io"} {
+		if strings.Contains(mainTemplate, host) {
+			t.Fatalf("expected the template to not load scripts from %s", host)
+		}
+	}
+
+	var missing []string
+	assets := templateAssets()
+	for _, url := range urls {
+		if _, ok := assets[url]; !ok {
+			missing = append(missing, url)
+		}
+	}
+	if len(missing) > 0 {
+		t.Fatalf("expected every asset of the template in runner/assets but %v are missing, run `go generate` and commit them", missing)
+	}
+
+	b := new(bytes.Buffer)
+	if err := WriteHTML(b, ExportData{Title: "Coyote"}, ReportOptions{SelfContained: true}); err != nil {
+		t.Fatal(err)
+	}
+	if tag := regexp.MustCompile(`<script[^>]* src="[^"]*"|<link[^>]* href="[^"]*"`).FindString(b.String()); tag != "" {
+		t.Fatalf("expected a self-contained report but it loads '%s'", tag)
+	}
+}
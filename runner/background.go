@@ -0,0 +1,321 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"syscall"
+	"time"
+
+	shellwords "github.com/mattn/go-shellwords"
+)
+
+const (
+	defaultReadyTimeout  = 30 * time.Second
+	defaultReadyInterval = 250 * time.Millisecond
+)
+
+// ReadyProbe tells when a background entry is ready, i.e when its server accepts connections.
+// All the probes that are set must pass.
+//
+// See `Entry.Background` for more.
+type ReadyProbe struct {
+	// Stdout is a regex expression that the stdout of the command should match.
+	Stdout string `yaml:"stdout,omitempty"`
+	// TCP is an address that should accept connections, e.g `localhost:8080`.
+	TCP string `yaml:"tcp,omitempty"`
+	// HTTP is a url that should respond with a status code below 400.
+	HTTP string `yaml:"http,omitempty"`
+	// Timeout is how long to wait for the probes to pass, a slow connection of a probe counts in it. Defaults to 30 seconds.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Interval is the wait between two checks of the probes, defaults to 250 milliseconds.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// check returns the first probe of "p" that does not pass against the running command with the output "stdout".
+// The connections of the probes are bounded by "ctx", not by the interval between the checks.
+func (p *ReadyProbe) check(ctx context.Context, stdout output) error {
+	if p.Stdout != "" {
+		pass, err := matchOutput(p.Stdout, stdout, false)
+		if err != nil {
+			return fmt.Errorf("stdout: bad regexp: %v", err)
+		}
+		if !pass {
+			return fmt.Errorf("stdout did not match '%s'", p.Stdout)
+		}
+	}
+
+	if p.TCP != "" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", p.TCP)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+
+	if p.HTTP != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.HTTP, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("%s responded with %s", p.HTTP, resp.Status)
+		}
+	}
+
+	return nil
+}
+
+// backgroundEntry is an entry that runs in the background of its group.
+type backgroundEntry struct {
+	v              Entry
+	cmd            *exec.Cmd
+	stdout, stderr *spool
+	start          time.Time
+	timer          *time.Timer
+	killSignal     syscall.Signal
+	killGrace      time.Duration
+
+	done chan struct{} // closed once the command exited.
+	err  error         // the error of the command, set before done is closed.
+
+	// result is the complete result of the entry, once it is stopped.
+	result *Result
+}
+
+// waitReady waits until the ready probe of the entry passes.
+// It fails if the command exits first, if the probe does not pass in time or if "ctx" is done.
+func (b *backgroundEntry) waitReady(ctx context.Context) error {
+	p := b.v.Ready
+	if p == nil {
+		return nil
+	}
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	interval := p.Interval
+	if interval <= 0 {
+		interval = defaultReadyInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+	checkCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	for {
+		err := p.check(checkCtx, b.stdout)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not ready after %s: %v", timeout, err)
+		}
+
+		select {
+		case <-b.done:
+			return fmt.Errorf("exited before it was ready: %v", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// runBackground starts the command of the background entry "v" and waits until it is ready.
+// Its status is "running" unless it failed to start or to get ready,
+// its complete result is returned by `GroupRun.Close` once it is stopped.
+func (g *GroupRun) runBackground(ctx context.Context, v Entry) Result {
+	r := g.r
+	r.prepare(&v, g.localVars)
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < v.Timeout {
+			v.Timeout = remaining
+		}
+	}
+	args, err := shellwords.Parse(v.Command)
+	if err != nil {
+		r.opts.Logger.Printf("Error when parsing command [ %s ] for [ %s ]\n", v.Command, v.Name)
+	}
+
+	if v.SleepBefore > 0 {
+		if !v.NoLog {
+			r.opts.Logger.Printf("Wait for %d seconds before run the test '%s'\n", int(v.SleepBefore.Seconds()), v.Name)
+		}
+		if !sleep(ctx, v.SleepBefore) {
+			return Result{Name: v.Name, Command: v.Command, Status: "not run", Exit: "not run", Test: v}
+		}
+	}
+
+	if len(args) == 0 { // Empty command?
+		r.opts.Logger.Printf("Entry %s is missing the command field.\n", v.Name)
+		return Result{Name: v.Name, Status: "error", Exit: "missing command", Stderr: []string{"the command field is missing"}, Test: v}
+	}
+	if v.ID != "" && g.runningBackground(v.ID) != nil {
+		return Result{Name: v.Name, Command: v.Command, Status: "error", Exit: "duplicate id",
+			Stderr: []string{fmt.Sprintf("a background entry with id '%s' is already running", v.ID)}, Test: v}
+	}
+
+	b := &backgroundEntry{v: v, stdout: new(spool), stderr: new(spool), done: make(chan struct{})}
+	if b.killSignal, b.killGrace, err = v.killPolicy(); err == nil {
+		b.cmd = exec.Command(args[0], args[1:]...)
+		setupCommand(b.cmd, v)
+		b.cmd.Stdout, b.cmd.Stderr = b.stdout, b.stderr
+		// Run in a process group, so that its children are stopped too.
+		setProcessGroup(b.cmd)
+
+		b.start = time.Now()
+		err = b.cmd.Start()
+	}
+	if err != nil {
+		b.stdout.Close()
+		b.stderr.Close()
+		t := r.classifyEntry(v, "", "", err, nil, true)
+		t.Test = v
+		return t
+	}
+
+	go func() {
+		b.err = b.cmd.Wait()
+		close(b.done)
+	}()
+	b.timer = time.AfterFunc(v.Timeout, func() {
+		r.terminate(b.cmd, v, "Timeout", b.killSignal, b.killGrace, b.done)
+	})
+	r.opts.Logger.Printf("Started in the background, command '%s', test '%s'\n", v.Command, v.Name)
+
+	if err := b.waitReady(ctx); err != nil {
+		r.opts.Logger.Printf("Not ready, command '%s', test '%s'. Error: %v\n", v.Command, v.Name, err)
+		t := g.stopBackground(b, err)
+		if ctx.Err() != nil {
+			t.Status = "interrupted"
+			t.Exit = "(interrupted) " + t.Exit
+		}
+		return t
+	}
+
+	g.background = append(g.background, b)
+	return Result{Name: v.Name, Command: v.Command, Status: "running", Exit: "running", Time: time.Since(b.start).Seconds(), Test: v}
+}
+
+// runningBackground returns the background entry with the "id" that is still running, if any.
+func (g *GroupRun) runningBackground(id string) *backgroundEntry {
+	for _, b := range g.background {
+		if b.v.ID == id && b.result == nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// runStop stops the background entry with the id of the `Stop` of the entry "v".
+// Its status is "ok" if the background entry was running, the status of the latter is in its own result.
+func (g *GroupRun) runStop(v Entry) Result {
+	g.r.prepare(&v, g.localVars)
+
+	t := Result{Name: v.Name, Command: "stop " + v.Stop, Test: v}
+	b := g.runningBackground(v.Stop)
+	if b == nil {
+		g.r.opts.Logger.Printf("Error, test '%s'. No background entry with id '%s' is running\n", v.Name, v.Stop)
+		t.Status, t.Exit = "error", "not running"
+		t.Stderr = []string{fmt.Sprintf("no background entry with id '%s' is running", v.Stop)}
+		return t
+	}
+
+	start := time.Now()
+	result := g.stopBackground(b, nil)
+	b.result = &result
+	t.Status, t.Exit = "ok", "0"
+	t.Time = time.Since(start).Seconds()
+	return t
+}
+
+// Close stops the background entries of the group that are still running, the last started first.
+// It returns the complete results of the background entries that were running,
+// in the order they started, see `Entry.Background`.
+func (g *GroupRun) Close() []Result {
+	for i := len(g.background) - 1; i >= 0; i-- {
+		if b := g.background[i]; b.result == nil {
+			result := g.stopBackground(b, nil)
+			b.result = &result
+		}
+	}
+
+	var results []Result
+	for _, b := range g.background {
+		results = append(results, *b.result)
+	}
+	g.background = nil
+	return results
+}
+
+// stopBackground stops the background entry "b", unless it already exited, and tests its outputs.
+// A command that runs until it is stopped passes, whatever its exit code.
+// The "notReady" error, if any, fails the entry.
+func (g *GroupRun) stopBackground(b *backgroundEntry, notReady error) Result {
+	r, v := g.r, b.v
+	defer b.stdout.Close()
+	defer b.stderr.Close()
+
+	stopped := false
+	select {
+	case <-b.done:
+	default:
+		stopped = true
+		r.terminate(b.cmd, v, "Stop", b.killSignal, b.killGrace, b.done)
+		<-b.done
+	}
+	timerLive := b.timer.Stop() // If command already exited, the timer is still live.
+	elapsed := time.Since(b.start)
+
+	runErr := b.err
+	if stopped && timerLive {
+		runErr = nil
+	}
+
+	_, textErr := v.test(b.stdout, b.stderr)
+	if notReady != nil {
+		if textErr != nil {
+			notReady = errors.New(notReady.Error() + "\n" + textErr.Error())
+		}
+		textErr = notReady
+	} else if regErr := v.Register.apply(b.stdout, b.stderr, g.localVars, r.setGlobalVar); regErr != nil {
+		if textErr != nil {
+			regErr = errors.New(textErr.Error() + regErr.Error())
+		}
+		textErr = regErr
+	}
+
+	t := r.classifyEntry(v, b.stdout.text(int64(v.MaxOutput)), b.stderr.text(int64(v.MaxOutput)), runErr, textErr, timerLive)
+	if _, sig, signaled := exitStatus(b.err); signaled {
+		t.Signal = signalName(sig)
+	}
+	if r.opts.ArtifactsDir != "" && !v.NoLog {
+		t.StdoutFile, t.StderrFile = r.saveArtifacts(v, b.stdout, b.stderr)
+	}
+	t.Time = elapsed.Seconds()
+	t.Test = v
+	return t
+}
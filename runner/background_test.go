@@ -0,0 +1,175 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyProbeCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		probe ReadyProbe
+		pass  bool
+	}{
+		{probe: ReadyProbe{Stdout: "listening on [0-9]+"}, pass: true},
+		{probe: ReadyProbe{Stdout: "started"}, pass: false},
+		{probe: ReadyProbe{TCP: ln.Addr().String()}, pass: true},
+		{probe: ReadyProbe{HTTP: srv.URL + "/health"}, pass: true},
+		{probe: ReadyProbe{HTTP: srv.URL + "/"}, pass: false},
+		{probe: ReadyProbe{Stdout: "listening", HTTP: srv.URL + "/"}, pass: false},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stdout := strings.NewReader("starting\nlistening on 8080\n")
+	for i, tt := range tests {
+		if err := tt.probe.check(ctx, stdout); (err == nil) != tt.pass {
+			t.Fatalf("[%d] expected the probe to pass: %t but got %v", i, tt.pass, err)
+		}
+	}
+}
+
+func TestReadyProbeSlow(t *testing.T) {
+	// The server answers slower than the interval between the checks.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		probe ReadyProbe
+		pass  bool
+	}{
+		{probe: ReadyProbe{HTTP: srv.URL, Interval: 50 * time.Millisecond, Timeout: 2 * time.Second}, pass: true},
+		{probe: ReadyProbe{HTTP: srv.URL, Interval: 50 * time.Millisecond, Timeout: 100 * time.Millisecond}, pass: false},
+	}
+
+	for i, tt := range tests {
+		probe := tt.probe
+		b := &backgroundEntry{v: Entry{Ready: &probe}, stdout: new(spool), done: make(chan struct{})}
+		start := time.Now()
+		err := b.waitReady(context.Background())
+		if (err == nil) != tt.pass {
+			t.Fatalf("[%d] expected the probe to pass: %t but got %v", i, tt.pass, err)
+		}
+		if elapsed := time.Since(start); !tt.pass && elapsed > time.Second {
+			t.Fatalf("[%d] expected the probe to stop at its timeout but took %s", i, elapsed)
+		}
+	}
+}
+
+func TestRunBackground(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires bash and process groups")
+	}
+
+	yamlContents := []byte(`
+- name: Background
+  entries:
+    - name: Server
+      command: bash -c 'echo "listening"; sleep 30 & wait'
+      background: true
+      id: server
+      ready:
+        stdout: listening
+      stdout_has: [ "listening" ]
+    - name: Teardown
+      command: bash -c 'echo "up"; sleep 30 & wait'
+      background: true
+      ready:
+        stdout: up
+      stdout_has: [ "down" ]
+    - name: Client
+      command: echo "request"
+    - name: Stop server
+      stop: server
+    - name: Stop again
+      stop: server
+    - name: Not ready
+      command: echo "exiting"
+      background: true
+      ready:
+        stdout: never`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected the background entries to be stopped but took %s", elapsed)
+	}
+
+	expected := []struct{ name, status string }{
+		{"Server", "ok"},
+		{"Teardown", "error"}, // its output is tested once it is stopped at the end of the group.
+		{"Client", "ok"},
+		{"Stop server", "ok"},
+		{"Stop again", "error"},
+		{"Not ready", "error"},
+	}
+	results := data.Results[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results but got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i].Name != e.name || results[i].Status != e.status {
+			t.Fatalf("[%d] expected '%s' with status '%s' but got '%s' with status '%s': %v", i, e.name, e.status, results[i].Name, results[i].Status, results[i].Stderr)
+		}
+	}
+
+	if got := strings.Join(results[0].Stdout, "\n"); got != "listening\n" {
+		t.Fatalf("expected the whole output of the background entry but got '%s'", got)
+	}
+	if got := strings.Join(results[5].Stderr, "\n"); !strings.Contains(got, "exited before it was ready") {
+		t.Fatalf("expected the background entry to fail as not ready but got '%s'", got)
+	}
+	if data.Successful != 3 || data.Errors != 3 {
+		t.Fatalf("expected 3 passed and 3 errors but got %d and %d", data.Successful, data.Errors)
+	}
+}
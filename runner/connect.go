@@ -0,0 +1,402 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type (
+	// ConnectStep talks to the REST API of Kafka Connect instead of running a command.
+	// It runs one of its actions on a connector, then waits until the connector and all of its tasks
+	// are in its `State`. The response of the action, or the status of the connector if it has a state,
+	// is the stdout of the entry, so the stdout assertions and registers apply to it.
+	ConnectStep struct {
+		URL         string         `yaml:"url"`
+		BasicAuth   *HTTPBasicAuth `yaml:"basic_auth,omitempty"`
+		BearerToken string         `yaml:"bearer_token,omitempty"`
+		TLS         *TLSOptions    `yaml:"tls,omitempty"`
+
+		// Create creates a connector, it fails if the connector exists.
+		Create *ConnectConnector `yaml:"create,omitempty"`
+		// Update updates the config of a connector, or creates it if it does not exist.
+		Update *ConnectConnector `yaml:"update,omitempty"`
+		// Delete, Pause, Resume and Restart are the names of the connectors to delete, pause, resume and restart.
+		// A connector is restarted with its tasks.
+		Delete  string `yaml:"delete,omitempty"`
+		Pause   string `yaml:"pause,omitempty"`
+		Resume  string `yaml:"resume,omitempty"`
+		Restart string `yaml:"restart,omitempty"`
+		// Status is the name of the connector to get the status of.
+		Status string `yaml:"status,omitempty"`
+
+		// State is the state that the connector and all of its tasks should be in,
+		// i.e RUNNING or PAUSED, then it has at least one task. It fails as soon as one of them is FAILED, with its trace.
+		State string `yaml:"state,omitempty"`
+		// Wait fails the step if the connector is not in its state in time, otherwise it waits until the timeout of the entry.
+		Wait time.Duration `yaml:"wait,omitempty"`
+		// Interval is the time between two checks of the state, defaults to 1s.
+		Interval time.Duration `yaml:"interval,omitempty"`
+	}
+
+	// ConnectConnector is a connector and its config.
+	ConnectConnector struct {
+		// Name defaults to the name in the config file.
+		Name   string            `yaml:"name,omitempty"`
+		Config map[string]string `yaml:"config,omitempty"`
+		// ConfigFile is a JSON file with the config, relative to the `WorkDir` of the entry.
+		// It is either the config or the request to create the connector, i.e `{"name": "sink", "config": {...}}`.
+		ConfigFile string `yaml:"config_file,omitempty"`
+	}
+
+	// connectStatus is the status of a connector.
+	connectStatus struct {
+		Name      string            `json:"name"`
+		Connector connectTaskStatus `json:"connector"`
+		Tasks     []struct {
+			ID int `json:"id"`
+			connectTaskStatus
+		} `json:"tasks"`
+	}
+
+	connectTaskStatus struct {
+		State string `json:"state"`
+		Trace string `json:"trace"`
+	}
+)
+
+// connectActions are the yaml fields of the actions of a `ConnectStep`, it runs exactly one of them.
+var connectActions = []string{"create", "update", "delete", "pause", "resume", "restart", "status"}
+
+// connectStates are the states of the connectors and their tasks.
+var connectStates = []string{"RUNNING", "PAUSED", "FAILED", "UNASSIGNED", "RESTARTING"}
+
+// checkConnectState returns an error if the "state" is not empty nor one of the `connectStates`.
+func checkConnectState(state string) error {
+	if state == "" {
+		return nil
+	}
+	for _, s := range connectStates {
+		if strings.ToUpper(state) == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("state '%s', expected one of %s", state, strings.Join(connectStates, ", "))
+}
+
+// String describes the action of the step, i.e `connect create sink`.
+func (c *ConnectStep) String() string {
+	action, name := c.action()
+	s := "connect " + action + " " + name
+	if c.State != "" {
+		s += " until " + strings.ToUpper(c.State)
+	}
+	return s
+}
+
+// action returns the action of the step and the name of its connector.
+func (c *ConnectStep) action() (action, name string) {
+	switch {
+	case c.Create != nil:
+		return "create", c.Create.name()
+	case c.Update != nil:
+		return "update", c.Update.name()
+	case c.Delete != "":
+		return "delete", c.Delete
+	case c.Pause != "":
+		return "pause", c.Pause
+	case c.Resume != "":
+		return "resume", c.Resume
+	case c.Restart != "":
+		return "restart", c.Restart
+	default:
+		return "status", c.Status
+	}
+}
+
+func (c *ConnectStep) client() restClient {
+	return restClient{URL: c.URL, BasicAuth: c.BasicAuth, BearerToken: c.BearerToken, TLS: c.TLS, ContentType: "application/json"}
+}
+
+// run runs the action of the step and writes its response or the status of the connector to "stdout"
+// and the requests to "stderr", then waits until the connector is in its state.
+func (c *ConnectStep) run(ctx context.Context, v Entry, stdout, stderr io.Writer) error {
+	if err := checkConnectState(c.State); err != nil {
+		return err
+	}
+	action, name := c.action()
+	out := stdout
+	if c.State != "" {
+		out = ioutil.Discard
+	}
+
+	client := c.client()
+	path := "connectors/" + url.PathEscape(name)
+	switch action {
+	case "create", "update":
+		connector := c.Create
+		if action == "update" {
+			connector = c.Update
+		}
+		config, err := connector.config(v.WorkDir)
+		if err != nil {
+			return err
+		}
+		if connector.Name == "" {
+			name, path = config["name"], "connectors/"+url.PathEscape(config["name"])
+		}
+		if name == "" {
+			return errors.New("connector has no name, in the step or in its config_file")
+		}
+
+		method, body := http.MethodPut, []byte(nil)
+		if action == "create" {
+			method, path = http.MethodPost, "connectors"
+			body, err = json.Marshal(map[string]interface{}{"name": config["name"], "config": config})
+		} else {
+			path += "/config"
+			body, err = json.Marshal(config)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := client.send(ctx, v, method, path, string(body), out, stderr); err != nil {
+			return err
+		}
+	case "delete":
+		if _, err := client.send(ctx, v, http.MethodDelete, path, "", out, stderr); err != nil {
+			return err
+		}
+	case "pause", "resume":
+		if _, err := client.send(ctx, v, http.MethodPut, path+"/"+action, "", out, stderr); err != nil {
+			return err
+		}
+	case "restart":
+		if _, err := client.send(ctx, v, http.MethodPost, path+"/restart?includeTasks=true", "", out, stderr); err != nil {
+			return err
+		}
+	default:
+		if c.State == "" {
+			_, err := client.send(ctx, v, http.MethodGet, path+"/status", "", stdout, stderr)
+			return err
+		}
+	}
+
+	if c.State == "" {
+		return nil
+	}
+	return c.waitState(ctx, v, name, stdout, stderr)
+}
+
+// waitState checks the status of the connector every `Interval` until it and its tasks are in the `State`,
+// then writes the status to "stdout". It fails with the trace of the connector or of a task that failed.
+func (c *ConnectStep) waitState(ctx context.Context, v Entry, name string, stdout, stderr io.Writer) error {
+	if c.Wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Wait)
+		defer cancel()
+	}
+	interval := c.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var (
+		state  = strings.ToUpper(c.State)
+		start  = time.Now()
+		client = c.client()
+		path   = "connectors/" + url.PathEscape(name) + "/status"
+
+		// Only the requests and the status of the last check are shown.
+		requests strings.Builder
+		last     []byte
+		lastErr  error // why the connector is not in its state yet.
+	)
+	for {
+		requests.Reset()
+		b, err := client.send(ctx, v, http.MethodGet, path, "", ioutil.Discard, &requests)
+
+		var status connectStatus
+		if err == nil {
+			err = json.Unmarshal(b, &status)
+		}
+		switch {
+		case err == nil:
+			last = b
+			done, failed := status.inState(state)
+			if done || failed != nil {
+				io.WriteString(stderr, requests.String())
+				stdout.Write(b)
+				if failed != nil {
+					return failed
+				}
+				fmt.Fprintf(stderr, "connector '%s' and its %d tasks are %s after %s\n", name, len(status.Tasks), state, time.Since(start).Round(time.Millisecond))
+				return nil
+			}
+			lastErr = errors.New(status.states())
+		case ctx.Err() == nil:
+			lastErr = err
+		case lastErr == nil:
+			lastErr = ctx.Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			io.WriteString(stderr, requests.String())
+			stdout.Write(last)
+			return fmt.Errorf("connector '%s' is not %s after %s: %v", name, state, time.Since(start).Round(time.Millisecond), lastErr)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// inState returns whether the connector and all of its tasks are in the "state",
+// or the error of the connector or of a task that failed.
+func (s connectStatus) inState(state string) (bool, error) {
+	if state != "FAILED" {
+		if s.Connector.State == "FAILED" {
+			return false, fmt.Errorf("connector '%s' is FAILED: %s", s.Name, firstLine(s.Connector.Trace))
+		}
+		for _, t := range s.Tasks {
+			if t.State == "FAILED" {
+				return false, fmt.Errorf("task %d of connector '%s' is FAILED: %s", t.ID, s.Name, firstLine(t.Trace))
+			}
+		}
+	}
+
+	if s.Connector.State != state || (len(s.Tasks) == 0 && (state == "RUNNING" || state == "PAUSED")) {
+		return false, nil
+	}
+	for _, t := range s.Tasks {
+		if t.State != state {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// states describes the states of the connector and its tasks, i.e `connector RUNNING, task 0 UNASSIGNED`.
+func (s connectStatus) states() string {
+	states := []string{"connector " + s.Connector.State}
+	for _, t := range s.Tasks {
+		states = append(states, fmt.Sprintf("task %d %s", t.ID, t.State))
+	}
+	if len(s.Tasks) == 0 {
+		states = append(states, "no tasks")
+	}
+	return strings.Join(states, ", ")
+}
+
+// firstLine returns the first line of a trace, the trace itself is in the stdout of the entry.
+func firstLine(trace string) string {
+	return strings.TrimSpace(strings.SplitN(trace, "\n", 2)[0])
+}
+
+// name returns the name of the connector, or its config file if the name is in the file.
+func (c *ConnectConnector) name() string {
+	if c.Name == "" {
+		return c.ConfigFile
+	}
+	return c.Name
+}
+
+// config returns the config of the connector, read from its file if it has one, with the name of the connector.
+func (c *ConnectConnector) config(workDir string) (map[string]string, error) {
+	if c.ConfigFile == "" {
+		return c.withName(c.Config), nil
+	}
+
+	file := c.ConfigFile
+	if workDir != "" && !filepath.IsAbs(file) {
+		file = filepath.Join(workDir, file)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var request struct {
+		Name   string            `json:"name"`
+		Config map[string]string `json:"config"`
+	}
+	if err := json.Unmarshal(b, &request); err == nil && request.Config != nil {
+		if _, ok := request.Config["name"]; !ok && request.Name != "" {
+			request.Config["name"] = request.Name
+		}
+		return c.withName(request.Config), nil
+	}
+	var config map[string]string
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("config_file '%s': %v", c.ConfigFile, err)
+	}
+	return c.withName(config), nil
+}
+
+// withName returns a copy of the "config" with the `Name` of the connector, if it has one.
+func (c *ConnectConnector) withName(config map[string]string) map[string]string {
+	named := make(map[string]string, len(config)+1)
+	for k, v := range config {
+		named[k] = v
+	}
+	if c.Name != "" {
+		named["name"] = c.Name
+	}
+	return named
+}
+
+// mapVars returns the step with the local and global vars mapped to its url, credentials, connectors and configs.
+func (c *ConnectStep) mapVars(localVars, globalVars map[string]string, u *uniques) *ConnectStep {
+	if c == nil {
+		return nil
+	}
+
+	mapped := *c
+	mapped.URL = replaceVars(c.URL, localVars, globalVars)
+	mapped.BearerToken = replaceVars(c.BearerToken, localVars, globalVars)
+	if c.BasicAuth != nil {
+		mapped.BasicAuth = &HTTPBasicAuth{
+			Username: replaceVars(c.BasicAuth.Username, localVars, globalVars),
+			Password: replaceVars(c.BasicAuth.Password, localVars, globalVars),
+		}
+	}
+	mapped.TLS = c.TLS.mapVars(localVars, globalVars)
+
+	mapConnector := func(connector *ConnectConnector) *ConnectConnector {
+		if connector == nil {
+			return nil
+		}
+		return &ConnectConnector{
+			Name:       replaceVars(u.replace(connector.Name), localVars, globalVars),
+			Config:     mapVarsMap(connector.Config, localVars, globalVars, u),
+			ConfigFile: replaceVars(connector.ConfigFile, localVars, globalVars),
+		}
+	}
+	mapped.Create = mapConnector(c.Create)
+	mapped.Update = mapConnector(c.Update)
+	for _, name := range []*string{&mapped.Delete, &mapped.Pause, &mapped.Resume, &mapped.Restart, &mapped.Status} {
+		*name = replaceVars(u.replace(*name), localVars, globalVars)
+	}
+	mapped.State = replaceVars(c.State, localVars, globalVars)
+	return &mapped
+}
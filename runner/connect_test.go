@@ -0,0 +1,247 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeConnect is a stand-in Kafka Connect that keeps its connectors in memory.
+// The tasks of a connector start on the second check of its status, they fail if its config has `fail: true`
+// until it is restarted, and it has no tasks if its config has `tasks.max: 0`.
+type fakeConnect struct {
+	mu         sync.Mutex
+	connectors map[string]*fakeConnector
+}
+
+type fakeConnector struct {
+	config map[string]string
+	state  string
+	checks int
+	failed bool
+}
+
+func (f *fakeConnect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(status int, message string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error_code": status, "message": message})
+	}
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if r.Method == http.MethodPost && len(path) == 1 {
+		var request struct {
+			Name   string            `json:"name"`
+			Config map[string]string `json:"config"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if _, ok := f.connectors[request.Name]; ok {
+			fail(http.StatusConflict, fmt.Sprintf("Connector %s already exists", request.Name))
+			return
+		}
+		f.connectors[request.Name] = &fakeConnector{config: request.Config, state: "RUNNING", failed: request.Config["fail"] == "true"}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(request)
+		return
+	}
+
+	name := path[1]
+	if len(path) == 3 && path[2] == "config" && r.Method == http.MethodPut {
+		var config map[string]string
+		json.NewDecoder(r.Body).Decode(&config)
+		if c, ok := f.connectors[name]; ok {
+			c.config = config
+		} else {
+			f.connectors[name] = &fakeConnector{config: config, state: "RUNNING", failed: config["fail"] == "true"}
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "config": config})
+		return
+	}
+
+	c, ok := f.connectors[name]
+	if !ok {
+		fail(http.StatusNotFound, fmt.Sprintf("Connector %s not found", name))
+		return
+	}
+	if len(path) == 2 {
+		delete(f.connectors, name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch path[2] {
+	case "pause":
+		c.state = "PAUSED"
+		w.WriteHeader(http.StatusAccepted)
+	case "resume":
+		c.state = "RUNNING"
+		w.WriteHeader(http.StatusAccepted)
+	case "restart":
+		if r.URL.Query().Get("includeTasks") == "true" {
+			c.failed = false
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "status":
+		c.checks++
+		type task struct {
+			ID    int    `json:"id"`
+			State string `json:"state"`
+			Trace string `json:"trace,omitempty"`
+		}
+		tasks := []task{}
+		if n, err := strconv.Atoi(c.config["tasks.max"]); err != nil || n > 0 {
+			t := task{State: c.state}
+			switch {
+			case c.checks < 2:
+				t.State = "UNASSIGNED"
+			case c.failed:
+				t.State, t.Trace = "FAILED", "org.apache.kafka.connect.errors.ConnectException: boom\n\tat Sink.put(Sink.java:42)"
+			}
+			tasks = append(tasks, t)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name": name, "connector": map[string]string{"state": c.state}, "tasks": tasks, "type": "sink",
+		})
+	}
+}
+
+func TestRunConnect(t *testing.T) {
+	srv := httptest.NewServer(&fakeConnect{connectors: make(map[string]*fakeConnector)})
+	defer srv.Close()
+
+	dir := t.TempDir()
+	config := `{"name": "sink", "config": {"connector.class": "FileStreamSink", "topics": "coyote-test"}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "sink.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	yamlContents := []byte(fmt.Sprintf(`
+- name: Connect
+  vars:
+    URL: %s
+  entries:
+    - name: Create
+      workdir: %s
+      connect:
+        url: "%%URL%%"
+        create: { config_file: sink.json }
+        state: RUNNING
+        interval: 10ms
+      stdout:
+        - json:
+            - path: $.tasks[0].state
+              equals: RUNNING
+    - name: Exists
+      workdir: %s
+      connect:
+        url: "%%URL%%"
+        create: { config_file: sink.json }
+    - name: Failing
+      connect:
+        url: "%%URL%%"
+        update:
+          name: failing
+          config: { connector.class: FileStreamSink, fail: "true" }
+        state: running
+        interval: 10ms
+      stdout_has: [ 'Sink.java:42' ]
+    - name: Restart
+      connect:
+        url: "%%URL%%"
+        restart: failing
+        state: RUNNING
+        interval: 10ms
+    - name: Pause
+      connect:
+        url: "%%URL%%"
+        pause: sink
+        state: PAUSED
+        interval: 10ms
+    - name: Status
+      connect:
+        url: "%%URL%%"
+        status: sink
+      stdout:
+        - json:
+            - path: $.connector.state
+              equals: PAUSED
+    - name: No tasks
+      connect:
+        url: "%%URL%%"
+        update: { name: empty, config: { tasks.max: "0" } }
+        state: RUNNING
+        wait: 100ms
+        interval: 10ms
+    - name: Delete
+      connect:
+        url: "%%URL%%"
+        delete: sink
+    - name: Deleted
+      connect:
+        url: "%%URL%%"
+        delete: sink`, srv.URL, dir, dir))
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ status, exit string }{
+		{"ok", "0"},
+		{"error", "status 409: Connector sink already exists (error code 409)"},
+		{"error", "task 0 of connector 'failing' is FAILED: org.apache.kafka.connect.errors.ConnectException: boom"},
+		{"ok", "0"},
+		{"ok", "0"},
+		{"ok", "0"},
+		{"error", "connector 'empty' is not RUNNING after "},
+		{"ok", "0"},
+		{"error", "status 404: Connector sink not found (error code 404)"},
+	}
+	results := data.Results[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results but got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i].Status != e.status || !strings.HasPrefix(results[i].Exit, e.exit) {
+			t.Fatalf("[%d] expected status '%s' and exit '%s' but got '%s' and '%s': %s", i, e.status, e.exit,
+				results[i].Status, results[i].Exit, strings.Join(results[i].Stderr, "\n"))
+		}
+	}
+
+	if command := results[0].Command; command != "connect create sink.json until RUNNING" {
+		t.Fatalf("expected the step to be described as a command but got '%s'", command)
+	}
+	if exit := results[6].Exit; !strings.HasSuffix(exit, ": connector RUNNING, no tasks") {
+		t.Fatalf("expected the states of the connector in the error but got '%s'", exit)
+	}
+}
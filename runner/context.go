@@ -1,4 +1,4 @@
-package main
+package runner
 
 import (
 	"fmt"
@@ -35,13 +35,20 @@ func (c *Context) toEntryGroup() []EntryGroup {
 
 	entryGroups = append(entryGroups, mainEntryGroup)
 
+	// The before and after entries run as setup and teardown, so the after entries run even on failures.
 	if len(c.Before) > 0 {
 		var beforeEntryGroup EntryGroup
 		beforeEntryGroup.Name = c.Describe + " | Before"
-		beforeEntryGroup.Entries = c.Before
+		beforeEntryGroup.Setup = c.Before
 		entryGroups = append(entryGroups, beforeEntryGroup)
 	}
 
+	// The specs may depend on each other by their own names.
+	specNames := make(map[string]bool, len(c.Specs))
+	for _, v := range c.Specs {
+		specNames[v.Name] = true
+	}
+
 	for _, v := range c.Specs {
 		var entryGroup EntryGroup
 
@@ -52,7 +59,18 @@ func (c *Context) toEntryGroup() []EntryGroup {
 		entryGroup.NoSkip = v.NoSkip
 		entryGroup.Type = v.Type
 		entryGroup.Vars = v.Vars
-		entryGroup.Entries = append(c.BeforeEach, append(append(v.Before, append(v.Entries, v.After...)...), c.AfterEach...)...)
+		entryGroup.Parallel = v.Parallel
+		entryGroup.OnFailure = v.OnFailure
+		entryGroup.Matrix = v.Matrix
+		for _, name := range v.DependsOn {
+			if specNames[name] {
+				name = c.Describe + " | " + name
+			}
+			entryGroup.DependsOn = append(entryGroup.DependsOn, name)
+		}
+		entryGroup.Setup = concatEntries(c.BeforeEach, v.Before, v.Setup)
+		entryGroup.Entries = v.Entries
+		entryGroup.Teardown = concatEntries(v.Teardown, v.After, c.AfterEach)
 
 		entryGroups = append(entryGroups, entryGroup)
 	}
@@ -60,13 +78,22 @@ func (c *Context) toEntryGroup() []EntryGroup {
 	if len(c.After) > 0 {
 		var afterEntryGroup EntryGroup
 		afterEntryGroup.Name = c.Describe + " | After"
-		afterEntryGroup.Entries = c.After
+		afterEntryGroup.Teardown = c.After
 		entryGroups = append(entryGroups, afterEntryGroup)
 	}
 
 	return entryGroups
 }
 
+// concatEntries returns the entries of all the "lists" in a new slice, so they never share their elements.
+func concatEntries(lists ...[]Entry) []Entry {
+	var entries []Entry
+	for _, list := range lists {
+		entries = append(entries, list...)
+	}
+	return entries
+}
+
 type ContextLoader interface {
 	Load(groups *[]EntryGroup) error
 }
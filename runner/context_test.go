@@ -1,4 +1,4 @@
-package main
+package runner
 
 import (
 	"bytes"
@@ -53,6 +53,14 @@ specs:
 	if len(groups) != 5 {
 		t.Fatal("Context must be converted to 5 EntryGroups")
 	}
+
+	// The before and after entries of each spec are its setup and teardown.
+	if g := groups[2]; len(g.Setup) != 1 || len(g.Entries) != 2 || len(g.Teardown) != 1 {
+		t.Fatalf("expected 1 setup, 2 entries and 1 teardown entries but got %d, %d and %d", len(g.Setup), len(g.Entries), len(g.Teardown))
+	}
+	if g := groups[4]; len(g.Teardown) != 1 || len(g.Entries) != 0 {
+		t.Fatalf("expected the after entries to be the teardown of the last group but got %d entries", len(g.Entries))
+	}
 }
 
 func TestVersionsCompatibility(t *testing.T) {
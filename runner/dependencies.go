@@ -0,0 +1,128 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SortGroups returns the "groups" in the order they should run, each one after the groups of its `DependsOn`.
+// The groups keep their order otherwise. It fails if a group depends on a group that does not exist
+// or if the dependencies form a cycle.
+func SortGroups(groups []EntryGroup) ([]EntryGroup, error) {
+	order, err := dependencyOrder(groups)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]EntryGroup, 0, len(groups))
+	for _, i := range order {
+		sorted = append(sorted, groups[i])
+	}
+	return sorted, nil
+}
+
+// dependencyOrder returns the indexes of the "groups" in the order they should run, see `SortGroups`.
+func dependencyOrder(groups []EntryGroup) ([]int, error) {
+	index := make(map[string]int, len(groups))
+	for i, g := range groups {
+		index[g.Name] = i
+	}
+
+	deps := make([][]int, len(groups))
+	for i, g := range groups {
+		for _, name := range g.DependsOn {
+			j, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("group '%s' depends on group '%s' which does not exist", g.Name, name)
+			}
+			deps[i] = append(deps[i], j)
+		}
+	}
+
+	var (
+		order  = make([]int, 0, len(groups))
+		placed = make([]bool, len(groups))
+	)
+	ready := func(i int) bool {
+		for _, j := range deps[i] {
+			if !placed[j] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Place the first group that is ready each time, so the groups keep their order unless they have to move.
+	for len(order) < len(groups) {
+		next := -1
+		for i := range groups {
+			if !placed[i] && ready(i) {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			return nil, dependencyCycle(groups, deps, placed)
+		}
+
+		placed[next] = true
+		order = append(order, next)
+	}
+
+	return order, nil
+}
+
+// dependencyCycleError is the error of groups that depend on each other,
+// it holds their names in the order they depend on each other, the first one is also the last one.
+type dependencyCycleError []string
+
+func (err dependencyCycleError) Error() string {
+	return "groups depend on each other: " + strings.Join(err, " -> ")
+}
+
+// dependencyCycle returns the error of a cycle among the groups that are not "placed", all of which wait for one another.
+func dependencyCycle(groups []EntryGroup, deps [][]int, placed []bool) error {
+	start := 0
+	for placed[start] {
+		start++
+	}
+
+	// Follow the dependencies that are not placed until one is visited twice.
+	var (
+		path    []int
+		visited = make(map[int]int) // the index of the groups in the path.
+	)
+	for i := start; ; {
+		if k, ok := visited[i]; ok {
+			path = append(path[k:], i)
+			break
+		}
+		visited[i] = len(path)
+		path = append(path, i)
+		for _, j := range deps[i] {
+			if !placed[j] {
+				i = j
+				break
+			}
+		}
+	}
+
+	names := make(dependencyCycleError, len(path))
+	for k, i := range path {
+		names[k] = groups[i].Name
+	}
+	return names
+}
@@ -0,0 +1,75 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSortGroups(t *testing.T) {
+	tests := []struct {
+		groups   []EntryGroup
+		expected string
+		err      string
+	}{
+		{
+			groups: []EntryGroup{
+				{Name: "Stream Reactor", DependsOn: []string{"Setup", "Connect"}},
+				{Name: "Brokers"},
+				{Name: "Connect", DependsOn: []string{"Brokers"}},
+				{Name: "Setup"},
+			},
+			expected: "Brokers,Connect,Setup,Stream Reactor",
+		},
+		{
+			groups:   []EntryGroup{{Name: "A"}, {Name: "B"}, {Name: "C", DependsOn: []string{"A"}}},
+			expected: "A,B,C",
+		},
+		{
+			groups: []EntryGroup{{Name: "A", DependsOn: []string{"Missing"}}},
+			err:    "group 'A' depends on group 'Missing' which does not exist",
+		},
+		{
+			groups: []EntryGroup{
+				{Name: "Start", DependsOn: []string{"A"}},
+				{Name: "A", DependsOn: []string{"B"}},
+				{Name: "B", DependsOn: []string{"C"}},
+				{Name: "C", DependsOn: []string{"A"}},
+			},
+			err: "groups depend on each other: A -> B -> C -> A",
+		},
+	}
+
+	for i, tt := range tests {
+		sorted, err := SortGroups(tt.groups)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("[%d] expected error '%s' but got %v", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("[%d] %v", i, err)
+		}
+
+		var names []string
+		for _, g := range sorted {
+			names = append(names, g.Name)
+		}
+		if got := strings.Join(names, ","); got != tt.expected {
+			t.Fatalf("[%d] expected the order '%s' but got '%s'", i, tt.expected, got)
+		}
+	}
+}
@@ -11,14 +11,13 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package runner
 
 import (
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
 	"strings"
 	"time"
 
@@ -57,6 +56,66 @@ type (
 		Stderr OutFilters `yaml:"stderr,omitempty"`
 
 		IgnoreExitCode bool `yaml:"ignore_exit_code,omitempty"`
+		// ExitCode are the expected exit codes, e.g `2`, `[1, 2]` or `"!0"`, instead of a zero exit code.
+		ExitCode ExitCodes `yaml:"exit_code,omitempty"`
+		// Signal is the expected signal that terminates the command, e.g `SIGKILL`.
+		Signal string `yaml:"signal,omitempty"`
+
+		// KillSignal is the signal sent to the command and all its child processes when it times out,
+		// defaults to `SIGKILL`, or to `SIGTERM` if a `KillGrace` is set.
+		KillSignal string `yaml:"kill_signal,omitempty"`
+		// KillGrace is the wait after the `KillSignal` before the processes still running are killed,
+		// defaults to 5 seconds if the `KillSignal` is not `SIGKILL`.
+		KillGrace time.Duration `yaml:"kill_grace,omitempty"`
+
+		// MaxOutput is the size of the stdout and of the stderr kept in the results, e.g `64KB`,
+		// only the head and the tail of a larger output are kept. The assertions always see the whole output.
+		// Defaults to `Options.MaxOutput`.
+		MaxOutput ByteSize `yaml:"max_output,omitempty"`
+
+		// Retries is the number of times the command runs again when it fails.
+		Retries int `yaml:"retries,omitempty"`
+		// RetryInterval is the wait before a retry, defaults to one second.
+		RetryInterval time.Duration `yaml:"retry_interval,omitempty"`
+		// RetryBackoff if greater than 1 multiplies the `RetryInterval` after each retry.
+		RetryBackoff float64 `yaml:"retry_backoff,omitempty"`
+		// Until if true polls the command until its output tests pass, up to `Retries` times,
+		// the exit code of the intermediate attempts is ignored.
+		Until bool `yaml:"until,omitempty"`
+
+		// Register captures values from the outputs as variables for the next entries.
+		Register Registers `yaml:"register,omitempty"`
+
+		// Background if true starts the command and runs the next entries of the group while it runs, i.e a mock server.
+		// It is stopped by a `Stop` entry or at the end of the group, then its outputs are tested.
+		Background bool `yaml:"background,omitempty"`
+		// ID names a background entry, so that a `Stop` entry can stop it.
+		ID string `yaml:"id,omitempty"`
+		// Ready tells when a background entry is ready, the next entries run once it is.
+		Ready *ReadyProbe `yaml:"ready,omitempty"`
+		// Stop is the `ID` of the background entry to stop, such an entry has no command.
+		Stop string `yaml:"stop,omitempty"`
+
+		// Critical if true aborts the run when the entry fails, like the `OnFailureAbort` of its group:
+		// the next entries and groups are skipped as their dependency failed. The teardowns still run.
+		Critical bool `yaml:"critical,omitempty"`
+
+		// HTTP is an http request to send instead of running a command.
+		HTTP *HTTPRequest `yaml:"http,omitempty"`
+		// Kafka talks to the Kafka brokers instead of running a command.
+		Kafka *KafkaStep `yaml:"kafka,omitempty"`
+		// SchemaRegistry talks to a schema registry instead of running a command.
+		SchemaRegistry *SchemaRegistryStep `yaml:"schema_registry,omitempty"`
+		// Connect talks to the REST API of Kafka Connect instead of running a command.
+		Connect *ConnectStep `yaml:"connect,omitempty"`
+		// WaitFor waits until ports, sockets, hosts or files are ready instead of running a command.
+		WaitFor *WaitFor `yaml:"wait_for,omitempty"`
+
+		// Foreach runs an instance of the entry for every combination of the values of its vars,
+		// i.e `TOPIC: [a, b]`, the values are vars of the instances over the local vars. See `ExpandMatrix`.
+		Foreach map[string][]string `yaml:"foreach,omitempty"`
+		// vars are the values of the `Foreach` of an instance of the entry.
+		vars map[string]string
 
 		// Skip will Skip only if "true".
 		// It's type of string instead of bool because it is meant to help with manipulating tests from scripts.
@@ -79,6 +138,9 @@ type (
 		// NotMatch should not match (against regex expression if NoRegex is false, default behavior).
 		NotMatch []string `yaml:"not_match,omitempty"`
 
+		// JSON are assertions on the values of the json output, see `JSONAssertion`.
+		JSON JSONAssertions `yaml:"json,omitempty"`
+
 		/* More options below... */
 
 		// NoRegex if true disables the regex matching, which is the default behavior.
@@ -112,34 +174,47 @@ func (filters OutFilters) GetNotMatches() (notMatches []string) {
 	return
 }
 
+// mapVars returns the filters with the local and global vars mapped to their matches and json assertions.
+func (filters OutFilters) mapVars(localVars, globalVars map[string]string, u *uniques) OutFilters {
+	if filters == nil {
+		return nil
+	}
+
+	mapped := make(OutFilters, len(filters))
+	for i, filter := range filters {
+		mapVars(localVars, globalVars, u, &filter.Match, &filter.NotMatch)
+		filter.JSON = filter.JSON.mapVars(localVars, globalVars, u)
+		mapped[i] = filter
+	}
+	return mapped
+}
+
 func removeNewLine(s string) string {
 	return strings.TrimRightFunc(s, func(c rune) bool {
 		return c == '\r' || c == '\n'
 	})
 }
 
-func canPassAgainstBackwards(against, output string, noregex bool) (bool, error) {
+func canPassAgainstBackwards(against string, o output, noregex bool) (bool, error) {
 	if noregex {
-		against, output = removeNewLine(against), removeNewLine(output)
-		return output == against, nil
+		return equalOutput(against, o), nil
 	}
-	return regexp.MatchString(against, output)
+	return matchOutput(against, o, false)
 }
 
-func canPassAgainst(against, output string, f OutFilter) (bool, error) {
+func canPassAgainst(against string, o output, f OutFilter) (bool, error) {
+	if f.NoRegex && f.Partial {
+		return matchOutput(removeNewLine(against), o, true)
+	}
 	if f.NoRegex {
-		against, output = removeNewLine(against), removeNewLine(output)
-		if f.Partial {
-			return strings.Contains(output, against), nil
-		}
-		return output == against, nil
+		return equalOutput(against, o), nil
 	}
 
 	if f.Partial {
-		return strings.Contains(output, against), nil
+		return matchOutput(against, o, true)
 	}
 
-	return regexp.MatchString(against, output)
+	return matchOutput(against, o, false)
 }
 
 // key -> the position of the test case for both stdout and stderr.
@@ -166,7 +241,7 @@ func (errs filterErrors) String() string {
 	return b.String()
 }
 
-func (f OutFilter) check(output string) (bool, error) {
+func (f OutFilter) check(o output) (bool, error) {
 	matchErrors, notMatchErrors := make(filterErrors), make(filterErrors)
 
 	for i, v := range f.Match {
@@ -175,7 +250,7 @@ func (f OutFilter) check(output string) (bool, error) {
 		}
 
 		// check for match.
-		pass, errPass := canPassAgainst(v, output, f)
+		pass, errPass := canPassAgainst(v, o, f)
 
 		if errPass != nil {
 			matchErrors[i] = append(matchErrors[i], fmt.Sprintf("match: bad regexp: %v.", errPass))
@@ -183,7 +258,7 @@ func (f OutFilter) check(output string) (bool, error) {
 
 		if !pass {
 			errMsg := fmt.Sprintf("match: should expected '%s'.", v)
-			if output == "" {
+			if o.Size() == 0 {
 				errMsg += " Output is empty ''."
 			}
 			matchErrors[i] = append(matchErrors[i], errMsg)
@@ -202,7 +277,7 @@ func (f OutFilter) check(output string) (bool, error) {
 		}
 
 		// check for not match (too).
-		pass, errPass := canPassAgainst(v, output, f)
+		pass, errPass := canPassAgainst(v, o, f)
 		if errPass != nil {
 			notMatchErrors[i] = append(notMatchErrors[i], fmt.Sprintf("not_match: bad regexp: %v.", errPass))
 		}
@@ -221,21 +296,21 @@ func (f OutFilter) check(output string) (bool, error) {
 		}
 	}
 
-	if errMsg := matchErrors.String() + notMatchErrors.String(); errMsg != "" {
+	if errMsg := matchErrors.String() + notMatchErrors.String() + f.JSON.errors(o); errMsg != "" {
 		return false, errors.New(errMsg)
 	}
 
 	return true, nil
 }
 
-func (e *Entry) testBackwards(stdout, stderr string) (bool, error) {
+func (e *Entry) testBackwards(stdout, stderr output) (bool, error) {
 	var errMsg string
 
 	for _, v := range e.StdoutExpect {
 		if v == "" {
 			continue
 		}
-		toMatch := replaceUnique(v)
+		toMatch := v
 		pass, errPass := canPassAgainstBackwards(toMatch, stdout, e.NoRegex)
 		if errPass != nil {
 			errMsg = fmt.Sprintf("%sStdout_has Bad Regexp: %v. \n", errMsg, errPass)
@@ -250,7 +325,7 @@ func (e *Entry) testBackwards(stdout, stderr string) (bool, error) {
 		if v == "" {
 			continue
 		}
-		toMatch := replaceUnique(v)
+		toMatch := v
 		pass, errPass := canPassAgainstBackwards(toMatch, stdout, e.NoRegex)
 		if errPass != nil {
 			errMsg = fmt.Sprintf("%sStdout_not_has Bad Regexp: %v. \n", errMsg, errPass)
@@ -271,7 +346,7 @@ func (e *Entry) testBackwards(stdout, stderr string) (bool, error) {
 		if v == "" {
 			continue
 		}
-		toMatch := replaceUnique(v)
+		toMatch := v
 		pass, errPass := canPassAgainstBackwards(toMatch, stderr, e.NoRegex)
 		if errPass != nil {
 			errMsg = fmt.Sprintf("%sStderr_has Bad Regexp: %v. \n", errMsg, errPass)
@@ -286,7 +361,7 @@ func (e *Entry) testBackwards(stdout, stderr string) (bool, error) {
 		if v == "" {
 			continue
 		}
-		toMatch := replaceUnique(v)
+		toMatch := v
 		pass, errPass := canPassAgainstBackwards(toMatch, stderr, e.NoRegex)
 		if errPass != nil {
 			errMsg = fmt.Sprintf("%sStderr_not_has Bad Regexp: %v. \n", errMsg, errPass)
@@ -306,11 +381,16 @@ func (e *Entry) testBackwards(stdout, stderr string) (bool, error) {
 	return true, nil
 }
 
-func mapVars(localVars, globalVars map[string]string, lists ...*[]string) {
+// The "lists" are replaced by new ones, so the copies of an entry never share their values.
+func mapVars(localVars, globalVars map[string]string, u *uniques, lists ...*[]string) {
 	for _, items := range lists {
-		tmp := *items
-		for i, item := range tmp {
-			result := replaceVars(replaceUnique(item), localVars, globalVars)
+		if *items == nil {
+			continue
+		}
+
+		tmp := make([]string, len(*items))
+		for i, item := range *items {
+			result := replaceVars(u.replace(item), localVars, globalVars)
 			tmp[i] = result
 		}
 
@@ -319,27 +399,50 @@ func mapVars(localVars, globalVars map[string]string, lists ...*[]string) {
 }
 
 // MapVars maps the local and global vars to the name, command, stdin, env_vars and (not) expected stdout and stderr.
+//
+// The named unique vars, i.e %UNIQUE_ID%, keep their value only within the call,
+// a `Run` keeps them for all of its entries.
 func (e *Entry) MapVars(localVars, globalVars map[string]string) { // note that local vars have priority over global vars.
+	e.mapVars(localVars, globalVars, newUniques())
+}
+
+func (e *Entry) mapVars(localVars, globalVars map[string]string, u *uniques) {
 	// If unique strings are asked, replace the placeholders
 	// Also replace local and global vars.
 	e.Name = replaceVars(e.Name, localVars, globalVars)
-	e.Command = replaceVars(replaceUnique(e.Command), localVars, globalVars)
-	e.Stdin = replaceVars(replaceUnique(e.Stdin), localVars, globalVars)
-	mapVars(localVars, globalVars, &e.EnvVars)
-
-	shouldFirstCheckForOld := len(e.StderrExpect) > 0 || len(e.StderrNotExpect) > 0
-	if shouldFirstCheckForOld {
-		mapVars(localVars, globalVars, &e.StdoutExpect, &e.StdoutNotExpect, &e.StderrExpect, &e.StderrNotExpect)
-	}
-
-	for _, filter := range e.Stdout {
-		mapVars(localVars, globalVars, &filter.Match, &filter.NotMatch)
+	e.Command = replaceVars(u.replace(e.Command), localVars, globalVars)
+	e.Stdin = replaceVars(u.replace(e.Stdin), localVars, globalVars)
+	mapVars(localVars, globalVars, u, &e.EnvVars)
+	mapVars(localVars, globalVars, u, &e.StdoutExpect, &e.StdoutNotExpect, &e.StderrExpect, &e.StderrNotExpect)
+
+	e.Stdout = e.Stdout.mapVars(localVars, globalVars, u)
+	e.Stderr = e.Stderr.mapVars(localVars, globalVars, u)
+
+	if e.Register != nil {
+		register := make(Registers, len(e.Register))
+		for i, r := range e.Register {
+			r.Regex = replaceVars(r.Regex, localVars, globalVars)
+			r.JSON = replaceVars(r.JSON, localVars, globalVars)
+			register[i] = r
+		}
+		e.Register = register
 	}
 
-	for _, filter := range e.Stderr {
-		mapVars(localVars, globalVars, &filter.Match, &filter.NotMatch)
+	e.HTTP = e.HTTP.mapVars(localVars, globalVars, u)
+	e.Kafka = e.Kafka.mapVars(localVars, globalVars, u)
+	e.SchemaRegistry = e.SchemaRegistry.mapVars(localVars, globalVars, u)
+	e.Connect = e.Connect.mapVars(localVars, globalVars, u)
+	e.WaitFor = e.WaitFor.mapVars(localVars, globalVars)
+
+	e.ID = replaceVars(e.ID, localVars, globalVars)
+	e.Stop = replaceVars(e.Stop, localVars, globalVars)
+	if e.Ready != nil {
+		ready := *e.Ready
+		ready.Stdout = replaceVars(u.replace(ready.Stdout), localVars, globalVars)
+		ready.TCP = replaceVars(ready.TCP, localVars, globalVars)
+		ready.HTTP = replaceVars(ready.HTTP, localVars, globalVars)
+		e.Ready = &ready
 	}
-
 }
 
 // Test runs the tests based on the entry's fields and returns false if failed.
@@ -348,6 +451,11 @@ func (e *Entry) MapVars(localVars, globalVars map[string]string) { // note that
 //
 // Call of `MapVars` is required if local or/and global variables declared.
 func (e *Entry) Test(stdout, stderr string) (bool, error) {
+	return e.test(strings.NewReader(stdout), strings.NewReader(stderr))
+}
+
+// test is the `Test` of the outputs of a command, which may be spooled to files.
+func (e *Entry) test(stdout, stderr output) (bool, error) {
 	// here we can mix the old and new syntax,
 	// first check if with the old syntax passed, if passed and has new syntax is there, check that as well, otherwise fail.
 	shouldFirstCheckForOld := len(e.StdoutExpect)+len(e.StdoutNotExpect)+len(e.StderrExpect)+len(e.StderrNotExpect) > 0
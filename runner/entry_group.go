@@ -11,7 +11,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package runner
 
 import (
 	"fmt"
@@ -30,6 +30,48 @@ type EntryGroup struct {
 	NoSkip      string            `yaml:"noskip,omitempty"`
 	Type        string            `yaml:"type,omitempty"`
 	Vars        map[string]string `yaml:"vars,omitempty"`
+	// Parallel if true lets the group run concurrently with other parallel groups,
+	// see the `-parallel` flag. Its entries still run in order.
+	Parallel bool `yaml:"parallel,omitempty"`
+
+	// Setup are the entries that run before the `Entries`, if one of them fails the entries are skipped.
+	Setup []Entry `yaml:"setup,omitempty"`
+	// Teardown are the entries that run after the `Entries`, even after failures, timeouts or interruptions,
+	// i.e to delete the topics of the group. Its results are reported apart from the ones of the entries.
+	Teardown []Entry `yaml:"teardown,omitempty"`
+
+	// OnFailure is what a failed setup entry or entry stops, one of `OnFailureContinue` (the default),
+	// `OnFailureSkipRest` or `OnFailureAbort`. The skipped entries are marked as skipped as their dependency failed.
+	// See the `-fail-fast` flag and `Entry.Critical` too.
+	OnFailure string `yaml:"on_failure,omitempty"`
+
+	// DependsOn are the names of the groups that should run before this one.
+	// It is skipped if any of them fails, see `SortGroups`.
+	DependsOn []string `yaml:"depends_on,omitempty"`
+
+	// Matrix runs an instance of the group for every combination of the values of its vars,
+	// i.e `PROTOCOL: [SASL, SSL]`, the values are local vars of the instances. See `ExpandMatrix`.
+	Matrix map[string][]string `yaml:"matrix,omitempty"`
+}
+
+// The values of `EntryGroup.OnFailure`.
+const (
+	// OnFailureContinue runs the next entries of the group and the next groups.
+	OnFailureContinue = "continue"
+	// OnFailureSkipRest skips the next entries of the group, its teardown still runs.
+	OnFailureSkipRest = "skip_rest"
+	// OnFailureAbort skips the next entries of the group and all the groups that did not run yet.
+	OnFailureAbort = "abort"
+)
+
+// checkOnFailure fails if "onFailure" is not a value of `EntryGroup.OnFailure`.
+func checkOnFailure(onFailure string) error {
+	switch onFailure {
+	case "", OnFailureContinue, OnFailureSkipRest, OnFailureAbort:
+		return nil
+	default:
+		return fmt.Errorf("on_failure '%s', expected %s, %s or %s", onFailure, OnFailureContinue, OnFailureSkipRest, OnFailureAbort)
+	}
 }
 
 // mergeEntryGroups appends the entries of the "newGroups" to the "groups".
@@ -47,8 +89,12 @@ func mergeEntryGroups(groups *[]EntryGroup, newGroups []EntryGroup) {
 					}
 				}
 
+				group.DependsOn = append(group.DependsOn, newGroup.DependsOn...)
+
 				// join entries.
+				group.Setup = append(group.Setup, newGroup.Setup...)
 				group.Entries = append(group.Entries, newGroup.Entries...)
+				group.Teardown = append(group.Teardown, newGroup.Teardown...)
 				(*groups)[i] = group
 				merged = true
 				break
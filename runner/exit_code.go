@@ -0,0 +1,216 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ExitCodes are the expected exit codes of a command, e.g `2`, `[1, 2]` or `"!0"`.
+// A code starting with "!" is not expected.
+// The command passes if its exit code is one of the expected codes (if any)
+// and none of the not expected ones.
+type ExitCodes []string
+
+// UnmarshalYAML accepts a single exit code as well as a list of them.
+func (codes *ExitCodes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var code string
+	if err := unmarshal(&code); err == nil {
+		*codes = ExitCodes{code}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*codes = list
+	return nil
+}
+
+// String returns the codes the way they were set, i.e "1, 2".
+func (codes ExitCodes) String() string {
+	return strings.Join(codes, ", ")
+}
+
+// validate reports the codes that are not numbers.
+func (codes ExitCodes) validate() error {
+	for _, code := range codes {
+		if _, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(code), "!")); err != nil {
+			return fmt.Errorf("bad exit_code '%s', expected a number optionally prefixed with '!'", code)
+		}
+	}
+	return nil
+}
+
+// match reports whether "exitCode" is expected.
+func (codes ExitCodes) match(exitCode int) bool {
+	hasExpected, expected := false, false
+	for _, code := range codes {
+		code = strings.TrimSpace(code)
+		if strings.HasPrefix(code, "!") {
+			if n, _ := strconv.Atoi(code[1:]); n == exitCode {
+				return false
+			}
+			continue
+		}
+
+		hasExpected = true
+		if n, _ := strconv.Atoi(code); n == exitCode {
+			expected = true
+		}
+	}
+
+	return expected || !hasExpected
+}
+
+// signals are the names of the signals that the `signal` field of an entry accepts.
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGILL":  syscall.SIGILL,
+	"SIGTRAP": syscall.SIGTRAP,
+	"SIGABRT": syscall.SIGABRT,
+	"SIGBUS":  syscall.SIGBUS,
+	"SIGFPE":  syscall.SIGFPE,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGSEGV": syscall.SIGSEGV,
+	"SIGPIPE": syscall.SIGPIPE,
+	"SIGALRM": syscall.SIGALRM,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// parseSignal returns the signal of "name", the "SIG" prefix is optional, i.e "SIGKILL", "kill" or "9".
+func parseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if n, err := strconv.Atoi(name); err == nil {
+		return syscall.Signal(n), nil
+	}
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig, ok := signals[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal '%s'", name)
+	}
+	return sig, nil
+}
+
+// signalName returns the name of "sig" as it appears in `signals`, i.e "SIGTERM".
+func signalName(sig syscall.Signal) string {
+	for name, s := range signals {
+		if s == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
+
+// exitStatus returns the exit code of the command that returned "err"
+// and the signal that terminated it, if any.
+// The exit code is -1 if the command did not exit by itself.
+func exitStatus(err error) (int, syscall.Signal, bool) {
+	if err == nil {
+		return 0, 0, false
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return -1, 0, false
+	}
+
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return -1, ws.Signal(), true
+	}
+	return exitErr.ExitCode(), 0, false
+}
+
+// hasExitExpectations reports whether the entry asserts on its exit code or signal,
+// instead of expecting a zero exit code.
+func (e *Entry) hasExitExpectations() bool {
+	return len(e.ExitCode) > 0 || e.Signal != ""
+}
+
+// checkExit compares the outcome "err" of the entry's command to its `ExitCode` and `Signal`
+// and returns an error describing the mismatch, if any.
+func (e *Entry) checkExit(err error) error {
+	code, sig, signaled := exitStatus(err)
+	if code == -1 && !signaled {
+		return err // the command did not run at all.
+	}
+
+	if e.Signal != "" {
+		expected, errSig := parseSignal(e.Signal)
+		if errSig != nil {
+			return errSig
+		}
+		if !signaled {
+			return fmt.Errorf("exit status %d (expected signal %s)", code, e.Signal)
+		}
+		if sig != expected {
+			return fmt.Errorf("signal: %s (expected signal %s)", sig, e.Signal)
+		}
+		return nil
+	}
+
+	if signaled {
+		return fmt.Errorf("signal: %s (expected exit code %s)", sig, e.ExitCode)
+	}
+
+	if err := e.ExitCode.validate(); err != nil {
+		return err
+	}
+	if !e.ExitCode.match(code) {
+		return fmt.Errorf("exit status %d (expected %s)", code, e.ExitCode)
+	}
+	return nil
+}
+
+// exitPassed reports whether the outcome "err" of the entry's command is acceptable,
+// regardless of its output tests.
+func (e *Entry) exitPassed(err error) bool {
+	if e.IgnoreExitCode {
+		return true
+	}
+	if e.hasExitExpectations() {
+		return e.checkExit(err) == nil
+	}
+	return err == nil
+}
+
+// killPolicy returns the signal sent to the command when it times out
+// and the wait before the processes still running are killed.
+func (e *Entry) killPolicy() (syscall.Signal, time.Duration, error) {
+	sig, grace := syscall.SIGKILL, e.KillGrace
+	if e.KillSignal != "" {
+		var err error
+		if sig, err = parseSignal(e.KillSignal); err != nil {
+			return 0, 0, err
+		}
+	} else if grace > 0 {
+		sig = syscall.SIGTERM
+	}
+
+	if sig != syscall.SIGKILL && grace <= 0 {
+		grace = 5 * time.Second
+	}
+	return sig, grace, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestExitCodesYAML(t *testing.T) {
+	yamlContents := []byte(`
+- name: Exit codes
+  entries:
+    - command: "false"
+      exit_code: 1
+    - command: "false"
+      exit_code: [1, 2]
+    - command: "false"
+      exit_code: "!0"`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ExitCodes{{"1"}, {"1", "2"}, {"!0"}}
+	for i, entry := range groups[0].Entries {
+		if !reflect.DeepEqual(entry.ExitCode, expected[i]) {
+			t.Fatalf("[%d] expected exit codes %v but got %v", i, expected[i], entry.ExitCode)
+		}
+	}
+}
+
+func TestExitCodesMatch(t *testing.T) {
+	tests := []struct {
+		codes    ExitCodes
+		exitCode int
+		pass     bool
+	}{
+		{ExitCodes{"2"}, 2, true},
+		{ExitCodes{"2"}, 0, false},
+		{ExitCodes{"1", "2"}, 1, true},
+		{ExitCodes{"1", "2"}, 3, false},
+		{ExitCodes{"!0"}, 1, true},
+		{ExitCodes{"!0"}, 0, false},
+		{ExitCodes{"!0", "!1"}, 1, false},
+		{ExitCodes{"!0", "!1"}, 2, true},
+	}
+
+	for i, tt := range tests {
+		if got := tt.codes.match(tt.exitCode); got != tt.pass {
+			t.Fatalf("[%d] exit code %d against '%s': expected %v but got %v", i, tt.exitCode, tt.codes, tt.pass, got)
+		}
+	}
+}
+
+func TestRunEntryExitExpectations(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires bash")
+	}
+
+	tests := []struct {
+		entry  Entry
+		status string
+		exit   string
+	}{
+		{Entry{Command: "bash -c 'exit 2'", ExitCode: ExitCodes{"2"}}, "ok", "2"},
+		{Entry{Command: "bash -c 'exit 1'", ExitCode: ExitCodes{"1", "2"}}, "ok", "1"},
+		{Entry{Command: "true", ExitCode: ExitCodes{"!0"}}, "error", "0 (expected !0)"},
+		{Entry{Command: "bash -c 'exit 3'", ExitCode: ExitCodes{"!0"}}, "ok", "3"},
+		{Entry{Command: "bash -c 'kill -KILL $$'", Signal: "SIGKILL"}, "ok", "signal: killed"},
+		{Entry{Command: "bash -c 'kill -TERM $$'", Signal: "KILL"}, "error", "signal: terminated (expected signal KILL)"},
+		{Entry{Command: "true", Signal: "SIGKILL"}, "error", "0 (expected signal SIGKILL)"},
+		{Entry{Command: "true", ExitCode: ExitCodes{"one"}}, "error", "bad exit_code 'one', expected a number optionally prefixed with '!'"},
+	}
+
+	for i, tt := range tests {
+		result := newTestRunner(t, nil, Options{}).runEntry(context.Background(), tt.entry, map[string]string{})
+		if result.Status != tt.status || result.Exit != tt.exit {
+			t.Fatalf("[%d] command '%s': expected status '%s' and exit '%s' but got '%s' and '%s'", i, tt.entry.Command, tt.status, tt.exit, result.Status, result.Exit)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// HTTPRequest is an http request that an entry sends instead of running a command.
+	// The body of the response is the stdout of the entry, so the stdout assertions and registers apply to it,
+	// and the request and response headers are its stderr, like the output of `curl -v`.
+	HTTPRequest struct {
+		// Method defaults to GET, or to POST if the request has a body.
+		Method  string            `yaml:"method,omitempty"`
+		URL     string            `yaml:"url"`
+		Headers map[string]string `yaml:"headers,omitempty"`
+		// Body is the body of the request, or BodyFile the file to read it from, relative to the `WorkDir` of the entry.
+		Body     string `yaml:"body,omitempty"`
+		BodyFile string `yaml:"body_file,omitempty"`
+		// BasicAuth or BearerToken set the Authorization header, its value is not shown in the results.
+		BasicAuth   *HTTPBasicAuth `yaml:"basic_auth,omitempty"`
+		BearerToken string         `yaml:"bearer_token,omitempty"`
+		TLS         *TLSOptions    `yaml:"tls,omitempty"`
+		// Timeout bounds the request, from connecting until the body of the response is read,
+		// it differs from the `Timeout` of the entry which bounds all its attempts.
+		Timeout time.Duration `yaml:"timeout,omitempty"`
+
+		// Status are the expected status codes of the response, e.g `200`, `[200, 201]` or `"!404"`,
+		// defaults to any status code below 400.
+		Status ExitCodes `yaml:"status,omitempty"`
+		// ResponseHeaders are regex expressions that the headers of the response should match, by their names.
+		ResponseHeaders map[string]string `yaml:"response_headers,omitempty"`
+	}
+
+	// HTTPBasicAuth are the credentials of an `HTTPRequest`.
+	HTTPBasicAuth struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password,omitempty"`
+	}
+)
+
+// String returns the method and the url of the request, i.e `GET http://localhost:8082/topics`.
+func (h *HTTPRequest) String() string {
+	return h.method() + " " + h.URL
+}
+
+func (h *HTTPRequest) method() string {
+	switch {
+	case h.Method != "":
+		return strings.ToUpper(h.Method)
+	case h.Body != "" || h.BodyFile != "":
+		return http.MethodPost
+	default:
+		return http.MethodGet
+	}
+}
+
+// run sends the request, writes the body of the response to "stdout" and the headers to "stderr",
+// then checks the status code and the headers of the response.
+func (h *HTTPRequest) run(ctx context.Context, v Entry, stdout, stderr io.Writer) error {
+	resp, err := h.send(ctx, v, stdout, stderr)
+	if err != nil {
+		return err
+	}
+
+	if len(h.Status) > 0 {
+		if err := h.Status.validate(); err != nil {
+			return err
+		}
+		if !h.Status.match(resp.StatusCode) {
+			return fmt.Errorf("status %d (expected %s)", resp.StatusCode, h.Status)
+		}
+	} else if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return checkHeaders(h.ResponseHeaders, resp.Header)
+}
+
+// send sends the request, writes the headers to "stderr" like `curl -v` and the body of the response to "stdout",
+// then returns the response, its body is closed.
+func (h *HTTPRequest) send(ctx context.Context, v Entry, stdout, stderr io.Writer) (*http.Response, error) {
+	body := strings.NewReader(h.Body)
+	if h.BodyFile != "" {
+		file := h.BodyFile
+		if v.WorkDir != "" && !filepath.IsAbs(file) {
+			file = filepath.Join(v.WorkDir, file)
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(string(b))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, h.method(), h.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	if a := h.BasicAuth; a != nil {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	if h.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.BearerToken)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if h.TLS != nil {
+		if transport.TLSClientConfig, err = h.TLS.config(v.WorkDir); err != nil {
+			return nil, err
+		}
+	}
+	client := &http.Client{Transport: transport, Timeout: h.Timeout}
+	defer client.CloseIdleConnections()
+
+	fmt.Fprintf(stderr, "> %s %s %s\n", req.Method, req.URL.RequestURI(), req.Proto)
+	fmt.Fprintf(stderr, "> Host: %s\n", req.URL.Host)
+	writeHeaders(stderr, "> ", req.Header)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	fmt.Fprintf(stderr, "< %s %s\n", resp.Proto, resp.Status)
+	writeHeaders(stderr, "< ", resp.Header)
+	if _, err := io.Copy(stdout, resp.Body); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// restClient sends the requests of the steps that talk to a REST API, i.e the schema registry and Kafka Connect.
+type restClient struct {
+	URL         string
+	BasicAuth   *HTTPBasicAuth
+	BearerToken string
+	TLS         *TLSOptions
+	// ContentType is the content type of the requests and the responses.
+	ContentType string
+}
+
+// send sends a request to the "path" of the API and returns the body of its response,
+// it fails with the error of the API if the status code is 400 or above.
+func (c restClient) send(ctx context.Context, v Entry, method, path, body string, stdout, stderr io.Writer) ([]byte, error) {
+	req := &HTTPRequest{
+		Method:      method,
+		URL:         strings.TrimSuffix(c.URL, "/") + "/" + path,
+		Headers:     map[string]string{"Accept": c.ContentType},
+		Body:        body,
+		BasicAuth:   c.BasicAuth,
+		BearerToken: c.BearerToken,
+		TLS:         c.TLS,
+	}
+	if body != "" {
+		req.Headers["Content-Type"] = c.ContentType
+	}
+
+	// The responses of the APIs are small, they are kept to be decoded.
+	var b bytes.Buffer
+	resp, err := req.send(ctx, v, io.MultiWriter(stdout, &b), stderr)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		// The Confluent APIs respond with the code and the message of their errors.
+		apiErr := &restError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(b.Bytes(), apiErr) != nil {
+			apiErr.ErrorCode, apiErr.Message = 0, ""
+		}
+		return nil, apiErr
+	}
+	return b.Bytes(), nil
+}
+
+// restError is the error of a `restClient` request that failed with the status code of its response.
+type restError struct {
+	StatusCode int    `json:"-"`
+	ErrorCode  int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *restError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status %d: %s (error code %d)", e.StatusCode, e.Message, e.ErrorCode)
+}
+
+// writeHeaders writes the "headers" to "w" sorted by their names, each line starts with the "prefix".
+// The value of the Authorization header is hidden.
+func writeHeaders(w io.Writer, prefix string, headers http.Header) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range headers[name] {
+			if name == "Authorization" {
+				value = strings.SplitN(value, " ", 2)[0] + " ***"
+			}
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+// checkHeaders returns the first of the "expected" regex expressions that the "headers" do not match, by their names.
+func checkHeaders(expected map[string]string, headers http.Header) error {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values, ok := headers[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return fmt.Errorf("header '%s' is missing", name)
+		}
+		value := strings.Join(values, ", ")
+
+		matched, err := regexp.MatchString(expected[name], value)
+		if err != nil {
+			return fmt.Errorf("header '%s': bad regexp: %v", name, err)
+		}
+		if !matched {
+			return fmt.Errorf("header '%s': '%s' does not match '%s'", name, value, expected[name])
+		}
+	}
+	return nil
+}
+
+// mapVars returns the request with the local and global vars mapped to its url, headers, body and credentials.
+func (h *HTTPRequest) mapVars(localVars, globalVars map[string]string, u *uniques) *HTTPRequest {
+	if h == nil {
+		return nil
+	}
+
+	mapped := *h
+	mapped.URL = replaceVars(u.replace(h.URL), localVars, globalVars)
+	mapped.Body = replaceVars(u.replace(h.Body), localVars, globalVars)
+	mapped.BodyFile = replaceVars(h.BodyFile, localVars, globalVars)
+	mapped.BearerToken = replaceVars(h.BearerToken, localVars, globalVars)
+	mapped.Headers = mapVarsMap(h.Headers, localVars, globalVars, u)
+	mapped.ResponseHeaders = mapVarsMap(h.ResponseHeaders, localVars, globalVars, u)
+	if h.BasicAuth != nil {
+		mapped.BasicAuth = &HTTPBasicAuth{
+			Username: replaceVars(h.BasicAuth.Username, localVars, globalVars),
+			Password: replaceVars(h.BasicAuth.Password, localVars, globalVars),
+		}
+	}
+	mapped.TLS = h.TLS.mapVars(localVars, globalVars)
+	return &mapped
+}
+
+// mapVarsMap returns a copy of "m" with the local and global vars mapped to its values.
+func mapVarsMap(m map[string]string, localVars, globalVars map[string]string, u *uniques) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	mapped := make(map[string]string, len(m))
+	for k, v := range m {
+		mapped[k] = replaceVars(u.replace(v), localVars, globalVars)
+	}
+	return mapped
+}
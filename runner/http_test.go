@@ -0,0 +1,179 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHTTP(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/topics":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.kafka.v2+json")
+			fmt.Fprint(w, `{"topics": ["coyote-test", "_schemas"], "id": 42}`)
+		case "/echo":
+			user, password, _ := r.BasicAuth()
+			body, _ := ioutil.ReadAll(r.Body)
+			fmt.Fprintf(w, "%s %s:%s %s %s", r.Method, user, password, r.Header.Get("Content-Type"), body)
+		case "/it's":
+			fmt.Fprint(w, r.URL.Path)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "record.json"), []byte(`{"value": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw})
+	if err := ioutil.WriteFile(filepath.Join(dir, "ca.pem"), caCert, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	yamlContents := []byte(fmt.Sprintf(`
+- name: REST Proxy
+  vars:
+    URL: %s
+    TLS_URL: %s
+    TOKEN: secret
+  entries:
+    - name: Topics
+      http:
+        url: "%%URL%%/topics"
+        bearer_token: "%%TOKEN%%"
+        status: 200
+        response_headers:
+          content-type: "^application/vnd.kafka"
+      stdout:
+        - json:
+            - path: $.topics[0]
+              equals: coyote-test
+      stderr_has: [ "Authorization: Bearer \\*\\*\\*", "< HTTP/1.1 200 OK" ]
+      register:
+        - name: ID
+          json: $.id
+    - name: Post
+      workdir: %s
+      http:
+        url: "%%URL%%/echo"
+        basic_auth: { username: coyote, password: "%%ID%%" }
+        headers:
+          Content-Type: application/json
+        body_file: record.json
+      stdout_has: [ "^POST coyote:42 application/json {\"value\": 1}$" ]
+    - name: Error
+      http:
+        url: "%%URL%%/missing"
+    - name: Expected error
+      http:
+        url: "%%URL%%/missing"
+        status: [ 500, 503 ]
+    - name: Wrong header
+      http:
+        url: "%%URL%%/topics"
+        bearer_token: "%%TOKEN%%"
+        response_headers:
+          Content-Type: ^application/json$
+    - name: Slow
+      timeout: 200ms
+      http:
+        url: "%%URL%%/slow"
+    - name: Slow request
+      http:
+        url: "%%URL%%/slow"
+        timeout: 200ms
+    - name: TLS
+      workdir: %s
+      http:
+        method: put
+        url: "%%TLS_URL%%/echo"
+        tls:
+          ca_cert: ca.pem
+          server_name: example.com
+      stdout_has: [ "^PUT" ]
+    - name: TLS unknown authority
+      http:
+        url: "%%TLS_URL%%/echo"
+    - name: Quoted url
+      http:
+        url: "%%URL%%/it's"
+      stdout_has: [ "^/it's$" ]`, srv.URL, tlsSrv.URL, dir, dir))
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ status, exit string }{
+		{"ok", "0"},
+		{"ok", "0"},
+		{"error", "status 500"},
+		{"ok", "0"},
+		{"error", "header 'Content-Type': 'application/vnd.kafka.v2+json' does not match '^application/json$'"},
+		{"timeout", ""},
+		{"error", ""},
+		{"ok", "0"},
+		{"error", ""},
+		{"ok", "0"},
+	}
+	results := data.Results[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results but got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i].Status != e.status || (e.exit != "" && results[i].Exit != e.exit) {
+			t.Fatalf("[%d] expected status '%s' and exit '%s' but got '%s' and '%s': %s", i, e.status, e.exit,
+				results[i].Status, results[i].Exit, strings.Join(results[i].Stderr, "\n"))
+		}
+	}
+
+	if command := results[0].Command; command != "GET "+srv.URL+"/topics" {
+		t.Fatalf("expected the request to be described as a command but got '%s'", command)
+	}
+	if !strings.Contains(results[6].Exit, "Client.Timeout") {
+		t.Fatalf("expected the request to time out but got '%s'", results[6].Exit)
+	}
+	if !strings.Contains(results[8].Exit, "certificate") {
+		t.Fatalf("expected the certificate of the server to be rejected but got '%s'", results[8].Exit)
+	}
+}
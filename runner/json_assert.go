@@ -0,0 +1,201 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+type (
+	// JSONAssertion describes an expectation on the value found under a json path
+	// of the command's output, e.g `{path: "$.tasks[0].state", equals: "RUNNING"}`.
+	//
+	// See `OutFilter` for more.
+	JSONAssertion struct {
+		// Path is the json path of the value, e.g `$.tasks[0].state` or `tasks.0.state`.
+		Path string `yaml:"path"`
+		// Exists if set checks whether the path exists (or not).
+		Exists *bool `yaml:"exists,omitempty"`
+		// Equals compares the value, strings as they are and anything else, lists and maps too, in its json form.
+		Equals interface{} `yaml:"equals,omitempty"`
+		// Match is a regex expression that the value should match.
+		Match string `yaml:"match,omitempty"`
+		// Length is the expected number of the elements of an array or object or the number of characters of a string.
+		Length *int `yaml:"length,omitempty"`
+
+		// Numeric comparisons.
+		GT  *float64 `yaml:"gt,omitempty"`
+		GTE *float64 `yaml:"gte,omitempty"`
+		LT  *float64 `yaml:"lt,omitempty"`
+		LTE *float64 `yaml:"lte,omitempty"`
+	}
+
+	// JSONAssertions is a set of `JSONAssertion`.
+	JSONAssertions []JSONAssertion
+)
+
+func (a JSONAssertion) hasValueChecks() bool {
+	return a.Equals != nil || a.Match != "" || a.Length != nil || a.GT != nil || a.GTE != nil || a.LT != nil || a.LTE != nil
+}
+
+// check returns an error describing the first expectation of "a" that the decoded json output "doc" does not meet.
+func (a JSONAssertion) check(doc interface{}) error {
+	value, exists, err := lookupJSONPath(doc, a.Path)
+	if err != nil {
+		return fmt.Errorf("json: %s: %v", a.Path, err)
+	}
+
+	if a.Exists != nil && *a.Exists != exists {
+		if exists {
+			return fmt.Errorf("json: %s: should not exist but got '%s'", a.Path, jsonValueString(value))
+		}
+		return fmt.Errorf("json: %s: should exist", a.Path)
+	}
+
+	if !exists {
+		if a.hasValueChecks() || a.Exists == nil {
+			return fmt.Errorf("json: %s: not found", a.Path)
+		}
+		return nil
+	}
+
+	got := jsonValueString(value)
+
+	if a.Equals != nil {
+		if expected := jsonValueString(yamlToJSON(a.Equals)); got != expected {
+			return fmt.Errorf("json: %s: expected '%s' but got '%s'", a.Path, expected, got)
+		}
+	}
+
+	if a.Match != "" {
+		pass, err := regexp.MatchString(a.Match, got)
+		if err != nil {
+			return fmt.Errorf("json: %s: bad regexp: %v", a.Path, err)
+		}
+		if !pass {
+			return fmt.Errorf("json: %s: expected to match '%s' but got '%s'", a.Path, a.Match, got)
+		}
+	}
+
+	if a.Length != nil {
+		var length int
+		switch v := value.(type) {
+		case []interface{}:
+			length = len(v)
+		case map[string]interface{}:
+			length = len(v)
+		case string:
+			length = utf8.RuneCountInString(v)
+		default:
+			return fmt.Errorf("json: %s: expected length %d but '%s' has no length", a.Path, *a.Length, got)
+		}
+		if length != *a.Length {
+			return fmt.Errorf("json: %s: expected length %d but got %d", a.Path, *a.Length, length)
+		}
+	}
+
+	if a.GT != nil || a.GTE != nil || a.LT != nil || a.LTE != nil {
+		var (
+			n        float64
+			errParse error
+		)
+		switch v := value.(type) {
+		case float64:
+			n = v
+		case json.Number:
+			n, errParse = v.Float64()
+		default:
+			n, errParse = strconv.ParseFloat(got, 64)
+		}
+		if errParse != nil {
+			return fmt.Errorf("json: %s: expected a number but got '%s'", a.Path, got)
+		}
+
+		switch {
+		case a.GT != nil && !(n > *a.GT):
+			return fmt.Errorf("json: %s: expected greater than %v but got %v", a.Path, *a.GT, n)
+		case a.GTE != nil && !(n >= *a.GTE):
+			return fmt.Errorf("json: %s: expected greater than or equal to %v but got %v", a.Path, *a.GTE, n)
+		case a.LT != nil && !(n < *a.LT):
+			return fmt.Errorf("json: %s: expected less than %v but got %v", a.Path, *a.LT, n)
+		case a.LTE != nil && !(n <= *a.LTE):
+			return fmt.Errorf("json: %s: expected less than or equal to %v but got %v", a.Path, *a.LTE, n)
+		}
+	}
+
+	return nil
+}
+
+// yamlToJSON returns the decoded yaml "value" with its maps keyed by strings, so it can be encoded in json.
+func yamlToJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = yamlToJSON(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = yamlToJSON(value)
+		}
+		return l
+	default:
+		return value
+	}
+}
+
+// errors returns the errors of all the assertions against the output "o", one per line.
+// The output is decoded once for all of them.
+func (assertions JSONAssertions) errors(o output) string {
+	if len(assertions) == 0 {
+		return ""
+	}
+
+	doc, errDecode := decodeJSON(o)
+	var errMsg string
+	for _, a := range assertions {
+		if errDecode != nil {
+			errMsg += fmt.Sprintf("json: %s: %v\n", a.Path, errDecode)
+			continue
+		}
+		if err := a.check(doc); err != nil {
+			errMsg += err.Error() + "\n"
+		}
+	}
+	return errMsg
+}
+
+// mapVars returns the assertions with the local and global vars mapped to their paths and expected values.
+func (assertions JSONAssertions) mapVars(localVars, globalVars map[string]string, u *uniques) JSONAssertions {
+	if assertions == nil {
+		return nil
+	}
+
+	mapped := make(JSONAssertions, len(assertions))
+	for i, a := range assertions {
+		a.Path = replaceVars(a.Path, localVars, globalVars)
+		a.Match = replaceVars(u.replace(a.Match), localVars, globalVars)
+		if equals, ok := a.Equals.(string); ok {
+			a.Equals = replaceVars(u.replace(equals), localVars, globalVars)
+		}
+		mapped[i] = a
+	}
+	return mapped
+}
@@ -0,0 +1,108 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutFilterJSON(t *testing.T) {
+	stdout := `{"name":"sink","connector":{"state":"RUNNING"},"tasks":[{"id":0,"state":"RUNNING"},{"id":1,"state":"FAILED","trace":"boom"}],"offset":"42","tags":["a","b"],"title":"café","id":9007199254740993,"ratio":1.50}`
+
+	yamlContents := []byte(`
+- name: JSON
+  entries:
+    - name: passes
+      stdout:
+        - json:
+            - path: $.connector.state
+              equals: RUNNING
+            - path: $.tasks
+              length: 2
+            - path: $.tasks[1].id
+              equals: 1
+            - path: tasks.0.state
+              match: ^RUN
+            - path: $.offset
+              gte: 42
+              lt: 100
+            - path: $.tasks[0].trace
+              exists: false
+            - path: $.name
+              exists: true
+            - path: $.tags
+              equals: [a, b]
+            - path: $.tasks[1]
+              equals: { id: 1, state: FAILED, trace: boom }
+            - path: $.title
+              length: 4
+            - path: $.id
+              equals: 9007199254740993
+            - path: $.id
+              gt: 9007199254740000
+            - path: $.ratio
+              equals: 1.5
+    - name: fails
+      stdout:
+        - json:
+            - path: $.tasks[1].state
+              equals: RUNNING
+            - path: $.tasks
+              length: 3
+            - path: $.offset
+              gt: 42
+            - path: $.tasks[1].trace
+              exists: false
+            - path: $.missing
+            - path: $.tags
+              equals: [b, a]
+            - path: $.id
+              equals: 9007199254740992`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	passes, fails := groups[0].Entries[0], groups[0].Entries[1]
+
+	if ok, err := passes.Test(stdout, ""); !ok {
+		t.Fatalf("expected to pass but failed: %v", err)
+	}
+
+	ok, err := fails.Test(stdout, "")
+	if ok {
+		t.Fatalf("expected to fail but passed")
+	}
+
+	expected := []string{
+		"stdout[0]: json: $.tasks[1].state: expected 'RUNNING' but got 'FAILED'",
+		"json: $.tasks: expected length 3 but got 2",
+		"json: $.offset: expected greater than 42 but got 42",
+		"json: $.tasks[1].trace: should not exist but got 'boom'",
+		"json: $.missing: not found",
+		`json: $.tags: expected '["b","a"]' but got '["a","b"]'`,
+		"json: $.id: expected '9007199254740992' but got '9007199254740993'",
+	}
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Fatalf("expected error to contain '%s' but got:\n%v", e, err)
+		}
+	}
+
+	if ok, err := passes.Test("not json", ""); ok || !strings.Contains(err.Error(), "output is not valid json") {
+		t.Fatalf("expected to fail on invalid json but got: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseJSONPath splits a path like `$.tasks[0].state`, `tasks.0.state` or `$["my key"]`
+// into its keys and indexes. The leading `$` is optional.
+func parseJSONPath(path string) ([]string, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+
+	var segments []string
+	for i := 0; i < len(path); {
+		switch c := path[i]; c {
+		case '.':
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("json path '%s': missing ']'", path)
+			}
+			segment := strings.TrimSpace(path[i+1 : i+end])
+			if unquoted, err := strconv.Unquote(segment); err == nil {
+				segment = unquoted
+			} else if len(segment) > 1 && segment[0] == '\'' && segment[len(segment)-1] == '\'' {
+				segment = segment[1 : len(segment)-1]
+			}
+			segments = append(segments, segment)
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end == -1 {
+				end = len(path) - i
+			}
+			segments = append(segments, path[i:i+end])
+			i += end
+		}
+	}
+
+	return segments, nil
+}
+
+// decodeJSON decodes the output "o" as a single json document, reading it as a stream.
+// Its integers are kept as `json.Number`, so ids and offsets above 2^53 keep all their digits,
+// any other number is a float64.
+func decodeJSON(o output) (interface{}, error) {
+	var doc interface{}
+	dec := json.NewDecoder(readerOf(o))
+	dec.UseNumber()
+	err := dec.Decode(&doc)
+	if err == nil {
+		if _, errMore := dec.Token(); errMore != io.EOF {
+			err = errors.New("invalid character after top-level value")
+		}
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("output is not valid json: %v", err)
+	}
+	return floatNumbers(doc), nil
+}
+
+// floatNumbers returns the decoded json "value" with the numbers that are not integers as float64.
+func floatNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			if f, err := v.Float64(); err == nil {
+				return f
+			}
+		}
+		return v
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = floatNumbers(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = floatNumbers(value)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// lookupJSONPath returns the value found under "path" of the decoded json document "doc".
+// The second return value reports whether the path exists.
+func lookupJSONPath(doc interface{}, path string) (interface{}, bool, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value := doc
+	for _, segment := range segments {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			v, ok := node[segment]
+			if !ok {
+				return nil, false, nil
+			}
+			value = v
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, false, fmt.Errorf("json path '%s': '%s' is not an array index", path, segment)
+			}
+			if idx < 0 {
+				idx += len(node)
+			}
+			if idx < 0 || idx >= len(node) {
+				return nil, false, nil
+			}
+			value = node[idx]
+		default:
+			return nil, false, nil
+		}
+	}
+
+	return value, true, nil
+}
+
+// jsonValueString returns strings as they are and any other json value in its encoded form.
+func jsonValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
@@ -0,0 +1,172 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// The JUnit XML format, as understood by Jenkins, GitLab and most CI servers.
+type (
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Name     string           `xml:"name,attr"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Errors   int              `xml:"errors,attr"`
+		Skipped  int              `xml:"skipped,attr"`
+		Time     string           `xml:"time,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name      string          `xml:"name,attr"`
+		Tests     int             `xml:"tests,attr"`
+		Failures  int             `xml:"failures,attr"`
+		Errors    int             `xml:"errors,attr"`
+		Skipped   int             `xml:"skipped,attr"`
+		Time      string          `xml:"time,attr"`
+		Timestamp string          `xml:"timestamp,attr,omitempty"`
+		TestCases []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		ClassName string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitMessage `xml:"failure,omitempty"`
+		Error     *junitMessage `xml:"error,omitempty"`
+		Skipped   *junitMessage `xml:"skipped,omitempty"`
+		SystemOut string        `xml:"system-out,omitempty"`
+		SystemErr string        `xml:"system-err,omitempty"`
+	}
+
+	junitMessage struct {
+		Message string `xml:"message,attr,omitempty"`
+		Type    string `xml:"type,attr,omitempty"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
+
+// junitTimestamp returns the "date" of the results as an xs:dateTime without its zone, i.e `2021-01-02T15:04:00`,
+// or an empty string if it is not a date.
+func junitTimestamp(date string) string {
+	t, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05")
+}
+
+// WriteJUnit writes the "data" to "w" as a JUnit XML report.
+// Each `ResultGroup` becomes a testsuite and each `Result` a testcase of it.
+// Timeouts and interruptions are reported as errors, any other failure as a failure
+// and the entries that did not run as skipped. The setup and teardown entries are testcases too,
+// their names start with "setup: " or "teardown: " and their failures are reported as errors.
+func WriteJUnit(w io.Writer, data ExportData) error {
+	suites := junitTestSuites{
+		Name: data.Title,
+		Time: junitTime(data.TotalTime),
+	}
+
+	for _, group := range data.Results {
+		suite := junitTestSuite{
+			Name:      group.Name,
+			Time:      junitTime(group.TotalTime),
+			Timestamp: junitTimestamp(data.Date),
+		}
+
+		var results []Result
+		var prefixes []string
+		for _, list := range []struct {
+			prefix  string
+			results []Result
+		}{{"setup: ", group.Setup}, {"", group.Results}, {"teardown: ", group.Teardown}} {
+			for _, result := range list.results {
+				results = append(results, result)
+				prefixes = append(prefixes, list.prefix)
+			}
+		}
+
+		for i, result := range results {
+			testCase := junitTestCase{
+				Name:      result.Name,
+				ClassName: group.Name,
+				Time:      junitTime(result.Time),
+				SystemOut: strings.Join(result.Stdout, "\n"),
+				SystemErr: strings.Join(result.Stderr, "\n"),
+			}
+			if testCase.Name == "" {
+				testCase.Name = result.Command
+			}
+			testCase.Name = prefixes[i] + testCase.Name
+
+			message := &junitMessage{
+				Message: "exit code: " + result.Exit,
+				Type:    result.Status,
+				Text:    result.Command,
+			}
+			switch result.Status {
+			case "ok":
+			case "skipped", "not run":
+				testCase.Skipped = &junitMessage{Message: result.Exit}
+				if result.SkipReason != "" {
+					testCase.Skipped.Message = result.SkipReason
+				}
+				suite.Skipped++
+			case "timeout", "interrupted":
+				testCase.Error = message
+				suite.Errors++
+			default:
+				if prefixes[i] != "" { // a setup or a teardown entry.
+					testCase.Error = message
+					suite.Errors++
+					break
+				}
+				testCase.Failure = message
+				suite.Failures++
+			}
+
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+		suite.Tests = len(suite.TestCases)
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
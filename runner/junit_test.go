@@ -0,0 +1,78 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	data := ExportData{
+		Title: "Kafka",
+		Date:  "2021 Jan 02, Sat, 15:04 UTC",
+		Results: []ResultGroup{
+			{
+				Name: "Brokers",
+				Results: []Result{
+					{Name: "Create Topic", Command: "kafka-topics --create", Status: "ok", Exit: "0", Time: 1.5, Stdout: []string{"Created topic"}},
+					{Name: "List Topics", Command: "kafka-topics --list", Status: "error", Exit: "1", Stderr: []string{"connection refused"}},
+				},
+				TotalTime: 1.5,
+			},
+			{
+				Name: "Connect",
+				Results: []Result{
+					{Command: "sleep 10", Status: "timeout", Exit: "(timeout) signal: killed"},
+				},
+			},
+		},
+	}
+
+	b := new(bytes.Buffer)
+	if err := WriteJUnit(b, data); err != nil {
+		t.Fatal(err)
+	}
+
+	var got junitTestSuites
+	if err := xml.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("output is not valid xml: %v\n%s", err, b.String())
+	}
+
+	if got.Tests != 3 || got.Failures != 1 || got.Errors != 1 {
+		t.Fatalf("unexpected totals: tests=%d failures=%d errors=%d", got.Tests, got.Failures, got.Errors)
+	}
+
+	if len(got.Suites) != 2 || got.Suites[0].Name != "Brokers" || got.Suites[0].Time != "1.500" {
+		t.Fatalf("unexpected test suites: %#v", got.Suites)
+	}
+
+	if timestamp := got.Suites[0].Timestamp; timestamp != "2021-01-02T15:04:00" {
+		t.Fatalf("expected the timestamp as an xs:dateTime but got '%s'", timestamp)
+	}
+
+	brokers := got.Suites[0].TestCases
+	if brokers[0].Failure != nil || brokers[0].SystemOut != "Created topic" {
+		t.Fatalf("expected passed test case with its stdout: %#v", brokers[0])
+	}
+	if brokers[1].Failure == nil || brokers[1].SystemErr != "connection refused" {
+		t.Fatalf("expected failed test case with its stderr: %#v", brokers[1])
+	}
+
+	connect := got.Suites[1].TestCases[0]
+	if connect.Error == nil || connect.Error.Type != "timeout" || connect.Name != "sleep 10" {
+		t.Fatalf("expected timed out test case named after its command: %#v", connect)
+	}
+}
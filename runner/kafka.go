@@ -0,0 +1,460 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// KafkaStep talks to the Kafka brokers instead of running a command, without needing the Kafka tools and a JVM.
+	// It runs one of its actions, the records it produces or consumes and the lag are written to the stdout as JSON,
+	// so the stdout assertions and registers apply to them.
+	KafkaStep struct {
+		// Brokers are the addresses of the brokers separated by commas, like the `bootstrap.servers` of the Kafka clients.
+		Brokers string `yaml:"brokers"`
+		// SecurityProtocol is PLAINTEXT (the default), SSL, SASL_PLAINTEXT or SASL_SSL, like the `security.protocol`.
+		SecurityProtocol string `yaml:"security_protocol,omitempty"`
+		// SASLMechanism is PLAIN (the default), SCRAM-SHA-256 or SCRAM-SHA-512, the password is not shown in the results.
+		SASLMechanism string `yaml:"sasl_mechanism,omitempty"`
+		SASLUsername  string `yaml:"sasl_username,omitempty"`
+		SASLPassword  string `yaml:"sasl_password,omitempty"`
+		// TLS configures the connections of the SSL and SASL_SSL protocols.
+		TLS *TLSOptions `yaml:"tls,omitempty"`
+
+		CreateTopic *KafkaCreateTopic `yaml:"create_topic,omitempty"`
+		DeleteTopic *KafkaDeleteTopic `yaml:"delete_topic,omitempty"`
+		Produce     *KafkaProduce     `yaml:"produce,omitempty"`
+		Consume     *KafkaConsume     `yaml:"consume,omitempty"`
+		Lag         *KafkaLag         `yaml:"lag,omitempty"`
+
+		newClient kafkaClientFunc // the client factory of the runner.
+	}
+
+	// KafkaCreateTopic creates a topic, it fails if the topic exists.
+	KafkaCreateTopic struct {
+		Topic string `yaml:"topic"`
+		// Partitions and ReplicationFactor default to 1.
+		Partitions        int32             `yaml:"partitions,omitempty"`
+		ReplicationFactor int16             `yaml:"replication_factor,omitempty"`
+		Configs           map[string]string `yaml:"configs,omitempty"`
+	}
+
+	// KafkaDeleteTopic deletes a topic, it fails if the topic does not exist.
+	KafkaDeleteTopic struct {
+		Topic string `yaml:"topic"`
+	}
+
+	// KafkaProduce produces the records to a topic, they are partitioned by their keys.
+	KafkaProduce struct {
+		Topic   string        `yaml:"topic"`
+		Records []KafkaRecord `yaml:"records"`
+	}
+
+	// KafkaConsume consumes a number of records of a topic from an offset.
+	KafkaConsume struct {
+		Topic string `yaml:"topic"`
+		// Partition is the only partition to consume, defaults to all of them.
+		Partition *int32 `yaml:"partition,omitempty"`
+		// Offset is where to start consuming each partition: earliest (the default), latest or an offset.
+		// The partitions of a consumer group start from its committed offsets instead, if it has any.
+		Offset string `yaml:"offset,omitempty"`
+		// Count is the number of records to consume, defaults to the number of the `Expect` records or to 1.
+		Count int `yaml:"count,omitempty"`
+		// Group is the consumer group to consume as, its offsets are committed once the records are consumed.
+		Group string `yaml:"group,omitempty"`
+		// Timeout fails the step if it did not consume the records in time,
+		// otherwise it waits for them until the timeout of the entry.
+		Timeout time.Duration `yaml:"timeout,omitempty"`
+		// Expect are regex expressions that the consumed records should match, in the order they were consumed.
+		Expect []KafkaRecordMatch `yaml:"expect,omitempty"`
+	}
+
+	// KafkaLag lists the lag of a consumer group.
+	KafkaLag struct {
+		Group string `yaml:"group"`
+		// Topic is the only topic to list the lag of, defaults to all the topics of the group.
+		Topic string `yaml:"topic,omitempty"`
+		// Max is the highest total lag the group may have.
+		Max *int64 `yaml:"max,omitempty"`
+	}
+
+	// KafkaRecord is a record that is produced or consumed.
+	KafkaRecord struct {
+		Topic     string            `yaml:"-" json:"topic"`
+		Partition int32             `yaml:"-" json:"partition"`
+		Offset    int64             `yaml:"-" json:"offset"`
+		Key       string            `yaml:"key,omitempty" json:"key"`
+		Value     string            `yaml:"value" json:"value"`
+		Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	}
+
+	// KafkaRecordMatch are the regex expressions that a consumed record should match.
+	KafkaRecordMatch struct {
+		Key     string            `yaml:"key,omitempty"`
+		Value   string            `yaml:"value,omitempty"`
+		Headers map[string]string `yaml:"headers,omitempty"`
+	}
+
+	// KafkaPartitionLag is the lag of a consumer group on a partition.
+	KafkaPartitionLag struct {
+		Topic     string `json:"topic"`
+		Partition int32  `json:"partition"`
+		Committed int64  `json:"committed"`
+		End       int64  `json:"end"`
+		Lag       int64  `json:"lag"`
+	}
+)
+
+// The security protocols and the SASL mechanisms of a `KafkaStep`.
+const (
+	KafkaPlaintext     = "PLAINTEXT"
+	KafkaSSL           = "SSL"
+	KafkaSASLPlaintext = "SASL_PLAINTEXT"
+	KafkaSASLSSL       = "SASL_SSL"
+
+	KafkaPlain       = "PLAIN"
+	KafkaScramSHA256 = "SCRAM-SHA-256"
+	KafkaScramSHA512 = "SCRAM-SHA-512"
+)
+
+// kafkaActions are the yaml fields of the actions of a `KafkaStep`, it runs exactly one of them.
+var kafkaActions = []string{"create_topic", "delete_topic", "produce", "consume", "lag"}
+
+// kafkaClient runs the actions of a `KafkaStep` against the brokers.
+type kafkaClient interface {
+	createTopic(ctx context.Context, t KafkaCreateTopic) error
+	deleteTopic(ctx context.Context, topic string) error
+	// produce returns the records with the partitions and the offsets they were produced to.
+	produce(ctx context.Context, topic string, records []KafkaRecord) ([]KafkaRecord, error)
+	// consume returns the "count" records it consumed, or the ones it consumed until "ctx" is done with its error.
+	consume(ctx context.Context, c KafkaConsume, offset int64, count int) ([]KafkaRecord, error)
+	// lag returns the lag of the group on each partition, sorted by topic and partition.
+	lag(ctx context.Context, group, topic string) ([]KafkaPartitionLag, error)
+}
+
+// kafkaClientFunc returns the client of the brokers of the step "k", with its files relative to the "workDir".
+// The runner passes it to the steps, see `Runner.prepare`.
+type kafkaClientFunc func(k *KafkaStep, workDir string) (kafkaClient, error)
+
+// The offsets of `KafkaConsume` that do not start from a known offset, like the ones of the Kafka protocol.
+const (
+	kafkaLatest   int64 = -1
+	kafkaEarliest int64 = -2
+)
+
+// parseKafkaOffset parses the offset of a `KafkaConsume`: earliest, latest or an offset.
+func parseKafkaOffset(s string) (int64, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "earliest":
+		return kafkaEarliest, nil
+	case "latest":
+		return kafkaLatest, nil
+	}
+
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("offset '%s' is not earliest, latest or an offset", s)
+	}
+	return offset, nil
+}
+
+// checkKafkaSecurity returns an error if the security protocol or the SASL mechanism is unknown.
+func checkKafkaSecurity(protocol, mechanism string) error {
+	switch strings.ToUpper(protocol) {
+	case "", KafkaPlaintext, KafkaSSL, KafkaSASLPlaintext, KafkaSASLSSL:
+	default:
+		return fmt.Errorf("security_protocol '%s', expected one of %s, %s, %s, %s", protocol,
+			KafkaPlaintext, KafkaSSL, KafkaSASLPlaintext, KafkaSASLSSL)
+	}
+	switch strings.ToUpper(mechanism) {
+	case "", KafkaPlain, KafkaScramSHA256, KafkaScramSHA512:
+	default:
+		return fmt.Errorf("sasl_mechanism '%s', expected one of %s, %s, %s", mechanism,
+			KafkaPlain, KafkaScramSHA256, KafkaScramSHA512)
+	}
+	return nil
+}
+
+// brokers returns the addresses of the brokers.
+func (k *KafkaStep) brokers() []string {
+	var brokers []string
+	for _, b := range strings.Split(k.Brokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	return brokers
+}
+
+// String describes the action of the step, i.e `kafka consume 3 records from coyote-test`.
+func (k *KafkaStep) String() string {
+	switch {
+	case k.CreateTopic != nil:
+		return "kafka create topic " + k.CreateTopic.Topic
+	case k.DeleteTopic != nil:
+		return "kafka delete topic " + k.DeleteTopic.Topic
+	case k.Produce != nil:
+		return fmt.Sprintf("kafka produce %d records to %s", len(k.Produce.Records), k.Produce.Topic)
+	case k.Consume != nil:
+		return fmt.Sprintf("kafka consume %d records from %s", k.Consume.count(), k.Consume.Topic)
+	case k.Lag != nil:
+		return "kafka lag of group " + k.Lag.Group
+	default:
+		return "kafka"
+	}
+}
+
+// count returns the number of records to consume.
+func (c *KafkaConsume) count() int {
+	switch {
+	case c.Count > 0:
+		return c.Count
+	case len(c.Expect) > 0:
+		return len(c.Expect)
+	default:
+		return 1
+	}
+}
+
+// run runs the action of the step, writes its records or lag to "stdout" as a JSON array with an element per line
+// and what it did to "stderr", then checks the consumed records and the lag.
+func (k *KafkaStep) run(ctx context.Context, v Entry, stdout, stderr io.Writer) error {
+	if err := checkKafkaSecurity(k.SecurityProtocol, k.SASLMechanism); err != nil {
+		return err
+	}
+	client, err := k.newClient(k, v.WorkDir)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	switch {
+	case k.CreateTopic != nil:
+		t := *k.CreateTopic
+		if t.Partitions == 0 {
+			t.Partitions = 1
+		}
+		if t.ReplicationFactor == 0 {
+			t.ReplicationFactor = 1
+		}
+		if err := client.createTopic(ctx, t); err != nil {
+			return err
+		}
+		fmt.Fprintf(stderr, "created topic %s with %d partitions and replication factor %d\n", t.Topic, t.Partitions, t.ReplicationFactor)
+		return nil
+	case k.DeleteTopic != nil:
+		if err := client.deleteTopic(ctx, k.DeleteTopic.Topic); err != nil {
+			return err
+		}
+		fmt.Fprintf(stderr, "deleted topic %s\n", k.DeleteTopic.Topic)
+		return nil
+	case k.Produce != nil:
+		records, err := client.produce(ctx, k.Produce.Topic, k.Produce.Records)
+		writeJSONLines(stdout, records)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stderr, "produced %d records to %s in %s\n", len(records), k.Produce.Topic, time.Since(start))
+		return nil
+	case k.Consume != nil:
+		return k.Consume.run(ctx, client, stdout, stderr)
+	case k.Lag != nil:
+		return k.Lag.run(ctx, client, stdout, stderr)
+	default:
+		return fmt.Errorf("kafka step has no action, expected one of %s", strings.Join(kafkaActions, ", "))
+	}
+}
+
+// run consumes the records and checks them against the `Expect` records.
+func (c *KafkaConsume) run(ctx context.Context, client kafkaClient, stdout, stderr io.Writer) error {
+	offset, err := parseKafkaOffset(c.Offset)
+	if err != nil {
+		return err
+	}
+
+	consumeCtx := ctx
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		consumeCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	start, count := time.Now(), c.count()
+	records, err := client.consume(consumeCtx, *c, offset, count)
+	writeJSONLines(stdout, records)
+	fmt.Fprintf(stderr, "consumed %d records from %s in %s\n", len(records), c.Topic, time.Since(start))
+	if err != nil {
+		// The timeout of the entry is reported by the runner, the one of the step fails it.
+		if ctx.Err() == nil && consumeCtx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("consumed %d of %d records in %s", len(records), count, c.Timeout)
+		}
+		return err
+	}
+
+	for i, m := range c.Expect {
+		if i >= len(records) {
+			return fmt.Errorf("record %d is missing", i)
+		}
+		if err := m.check(records[i]); err != nil {
+			return fmt.Errorf("record %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// check returns the first of the regex expressions that the "record" does not match.
+func (m KafkaRecordMatch) check(record KafkaRecord) error {
+	match := func(field, expr, value string) error {
+		if expr == "" {
+			return nil
+		}
+		matched, err := regexp.MatchString(expr, value)
+		if err != nil {
+			return fmt.Errorf("%s: bad regexp: %v", field, err)
+		}
+		if !matched {
+			return fmt.Errorf("%s '%s' does not match '%s'", field, value, expr)
+		}
+		return nil
+	}
+
+	if err := match("key", m.Key, record.Key); err != nil {
+		return err
+	}
+	if err := match("value", m.Value, record.Value); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := record.Headers[name]
+		if !ok {
+			return fmt.Errorf("header '%s' is missing", name)
+		}
+		if err := match("header '"+name+"'", m.Headers[name], value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run lists the lag of the group and checks it against the `Max` lag.
+func (l *KafkaLag) run(ctx context.Context, client kafkaClient, stdout, stderr io.Writer) error {
+	lags, err := client.lag(ctx, l.Group, l.Topic)
+	if err != nil {
+		return err
+	}
+	writeJSONLines(stdout, lags)
+
+	var total int64
+	for _, p := range lags {
+		total += p.Lag
+	}
+	fmt.Fprintf(stderr, "group %s has a lag of %d on %d partitions\n", l.Group, total, len(lags))
+
+	if l.Max != nil && total > *l.Max {
+		return fmt.Errorf("lag %d of group '%s' is above %d", total, l.Group, *l.Max)
+	}
+	return nil
+}
+
+// writeJSONLines writes the "items" slice as a JSON array, each item on its own line,
+// so that the json assertions and the regex expressions of the lines both work on them.
+func writeJSONLines(w io.Writer, items interface{}) {
+	var lines []json.RawMessage
+	b, _ := json.Marshal(items)
+	json.Unmarshal(b, &lines)
+
+	fmt.Fprintln(w, "[")
+	for i, line := range lines {
+		if i < len(lines)-1 {
+			fmt.Fprintf(w, "%s,\n", line)
+		} else {
+			fmt.Fprintf(w, "%s\n", line)
+		}
+	}
+	fmt.Fprintln(w, "]")
+}
+
+// mapVars returns the step with the local and global vars mapped to its brokers, credentials, topics,
+// records and expected records.
+func (k *KafkaStep) mapVars(localVars, globalVars map[string]string, u *uniques) *KafkaStep {
+	if k == nil {
+		return nil
+	}
+
+	mapped := *k
+	mapped.Brokers = replaceVars(k.Brokers, localVars, globalVars)
+	mapped.SASLUsername = replaceVars(k.SASLUsername, localVars, globalVars)
+	mapped.SASLPassword = replaceVars(k.SASLPassword, localVars, globalVars)
+	mapped.TLS = k.TLS.mapVars(localVars, globalVars)
+
+	if t := k.CreateTopic; t != nil {
+		mapped.CreateTopic = &KafkaCreateTopic{
+			Topic:             replaceVars(u.replace(t.Topic), localVars, globalVars),
+			Partitions:        t.Partitions,
+			ReplicationFactor: t.ReplicationFactor,
+			Configs:           mapVarsMap(t.Configs, localVars, globalVars, u),
+		}
+	}
+	if t := k.DeleteTopic; t != nil {
+		mapped.DeleteTopic = &KafkaDeleteTopic{Topic: replaceVars(u.replace(t.Topic), localVars, globalVars)}
+	}
+	if p := k.Produce; p != nil {
+		produce := &KafkaProduce{Topic: replaceVars(u.replace(p.Topic), localVars, globalVars)}
+		for _, r := range p.Records {
+			produce.Records = append(produce.Records, KafkaRecord{
+				Key:     replaceVars(u.replace(r.Key), localVars, globalVars),
+				Value:   replaceVars(u.replace(r.Value), localVars, globalVars),
+				Headers: mapVarsMap(r.Headers, localVars, globalVars, u),
+			})
+		}
+		mapped.Produce = produce
+	}
+	if c := k.Consume; c != nil {
+		consume := *c
+		consume.Topic = replaceVars(u.replace(c.Topic), localVars, globalVars)
+		consume.Offset = replaceVars(c.Offset, localVars, globalVars)
+		consume.Group = replaceVars(u.replace(c.Group), localVars, globalVars)
+		consume.Expect = nil
+		for _, m := range c.Expect {
+			consume.Expect = append(consume.Expect, KafkaRecordMatch{
+				Key:     replaceVars(u.replace(m.Key), localVars, globalVars),
+				Value:   replaceVars(u.replace(m.Value), localVars, globalVars),
+				Headers: mapVarsMap(m.Headers, localVars, globalVars, u),
+			})
+		}
+		mapped.Consume = &consume
+	}
+	if l := k.Lag; l != nil {
+		lag := *l
+		lag.Group = replaceVars(u.replace(l.Group), localVars, globalVars)
+		lag.Topic = replaceVars(u.replace(l.Topic), localVars, globalVars)
+		mapped.Lag = &lag
+	}
+	return &mapped
+}
@@ -0,0 +1,240 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// franzClient is the `kafkaClient` of the franz-go Kafka client, it connects to the brokers for each action.
+type franzClient struct {
+	opts []kgo.Opt
+}
+
+// newFranzClient is the `kafkaClientFunc` of the runner.
+func newFranzClient(k *KafkaStep, workDir string) (kafkaClient, error) {
+	brokers := k.brokers()
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka step has no brokers")
+	}
+	opts := []kgo.Opt{kgo.SeedBrokers(brokers...)}
+
+	protocol := strings.ToUpper(k.SecurityProtocol)
+	if protocol == KafkaSSL || protocol == KafkaSASLSSL {
+		config := new(tls.Config)
+		if k.TLS != nil {
+			var err error
+			if config, err = k.TLS.config(workDir); err != nil {
+				return nil, err
+			}
+		}
+		opts = append(opts, kgo.DialTLSConfig(config))
+	}
+	if protocol == KafkaSASLPlaintext || protocol == KafkaSASLSSL {
+		switch strings.ToUpper(k.SASLMechanism) {
+		case "", KafkaPlain:
+			opts = append(opts, kgo.SASL(plain.Auth{User: k.SASLUsername, Pass: k.SASLPassword}.AsMechanism()))
+		case KafkaScramSHA256:
+			opts = append(opts, kgo.SASL(scram.Auth{User: k.SASLUsername, Pass: k.SASLPassword}.AsSha256Mechanism()))
+		case KafkaScramSHA512:
+			opts = append(opts, kgo.SASL(scram.Auth{User: k.SASLUsername, Pass: k.SASLPassword}.AsSha512Mechanism()))
+		}
+	}
+
+	return &franzClient{opts: opts}, nil
+}
+
+// client returns a client of the brokers with the extra options.
+func (c *franzClient) client(opts ...kgo.Opt) (*kgo.Client, error) {
+	return kgo.NewClient(append(append([]kgo.Opt{}, c.opts...), opts...)...)
+}
+
+func (c *franzClient) createTopic(ctx context.Context, t KafkaCreateTopic) error {
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	var configs map[string]*string
+	if len(t.Configs) > 0 {
+		configs = make(map[string]*string, len(t.Configs))
+		for k, v := range t.Configs {
+			configs[k] = kadm.StringPtr(v)
+		}
+	}
+	_, err = kadm.NewClient(cl).CreateTopic(ctx, t.Partitions, t.ReplicationFactor, configs, t.Topic)
+	return err
+}
+
+func (c *franzClient) deleteTopic(ctx context.Context, topic string) error {
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	_, err = kadm.NewClient(cl).DeleteTopic(ctx, topic)
+	return err
+}
+
+func (c *franzClient) produce(ctx context.Context, topic string, records []KafkaRecord) ([]KafkaRecord, error) {
+	cl, err := c.client(kgo.DefaultProduceTopic(topic))
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+
+	rs := make([]*kgo.Record, len(records))
+	for i, r := range records {
+		rs[i] = &kgo.Record{Value: []byte(r.Value)}
+		if r.Key != "" {
+			rs[i].Key = []byte(r.Key)
+		}
+		names := make([]string, 0, len(r.Headers))
+		for name := range r.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rs[i].Headers = append(rs[i].Headers, kgo.RecordHeader{Key: name, Value: []byte(r.Headers[name])})
+		}
+	}
+
+	results := cl.ProduceSync(ctx, rs...)
+	var produced []KafkaRecord
+	for _, result := range results {
+		if result.Err == nil {
+			produced = append(produced, kafkaRecord(result.Record))
+		}
+	}
+	return produced, results.FirstErr()
+}
+
+func (c *franzClient) consume(ctx context.Context, consume KafkaConsume, offset int64, count int) ([]KafkaRecord, error) {
+	start := kgo.NewOffset().AtStart()
+	switch offset {
+	case kafkaEarliest:
+	case kafkaLatest:
+		start = kgo.NewOffset().AtEnd()
+	default:
+		start = kgo.NewOffset().At(offset)
+	}
+
+	var opts []kgo.Opt
+	switch {
+	case consume.Partition != nil:
+		opts = append(opts, kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{
+			consume.Topic: {*consume.Partition: start},
+		}))
+	case consume.Group != "":
+		opts = append(opts, kgo.ConsumeTopics(consume.Topic), kgo.ConsumeResetOffset(start),
+			kgo.ConsumerGroup(consume.Group), kgo.DisableAutoCommit())
+	default:
+		opts = append(opts, kgo.ConsumeTopics(consume.Topic), kgo.ConsumeResetOffset(start))
+	}
+
+	cl, err := c.client(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+
+	var records []KafkaRecord
+	for len(records) < count {
+		fetches := cl.PollRecords(ctx, count-len(records))
+		fetches.EachRecord(func(r *kgo.Record) {
+			records = append(records, kafkaRecord(r))
+		})
+		if err := ctx.Err(); err != nil {
+			return records, err
+		}
+		for _, e := range fetches.Errors() {
+			return records, fmt.Errorf("%s[%d]: %v", e.Topic, e.Partition, e.Err)
+		}
+	}
+
+	if consume.Group != "" {
+		if err := cl.CommitUncommittedOffsets(ctx); err != nil {
+			return records, err
+		}
+	}
+	return records, nil
+}
+
+func (c *franzClient) lag(ctx context.Context, group, topic string) ([]KafkaPartitionLag, error) {
+	cl, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+
+	lags, err := kadm.NewClient(cl).Lag(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := lags[group]
+	if !ok || l.State == "Dead" {
+		return nil, fmt.Errorf("group '%s' does not exist", group)
+	}
+	if err := l.Error(); err != nil {
+		return nil, err
+	}
+
+	var partitions []KafkaPartitionLag
+	for _, m := range l.Lag.Sorted() {
+		if topic != "" && m.Topic != topic {
+			continue
+		}
+		if m.Err != nil {
+			return nil, fmt.Errorf("%s[%d]: %v", m.Topic, m.Partition, m.Err)
+		}
+		partitions = append(partitions, KafkaPartitionLag{
+			Topic:     m.Topic,
+			Partition: m.Partition,
+			Committed: m.Commit.At,
+			End:       m.End.Offset,
+			Lag:       m.Lag,
+		})
+	}
+	return partitions, nil
+}
+
+// kafkaRecord returns the record "r" of the franz-go client.
+func kafkaRecord(r *kgo.Record) KafkaRecord {
+	record := KafkaRecord{
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Offset:    r.Offset,
+		Key:       string(r.Key),
+		Value:     string(r.Value),
+	}
+	if len(r.Headers) > 0 {
+		record.Headers = make(map[string]string, len(r.Headers))
+		for _, h := range r.Headers {
+			record.Headers[h.Key] = string(h.Value)
+		}
+	}
+	return record
+}
@@ -0,0 +1,262 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// newKafkaCluster starts an in-process Kafka cluster of one broker for the test and returns its address.
+func newKafkaCluster(t *testing.T, opts ...kfake.Opt) string {
+	t.Helper()
+	cluster, err := kfake.NewCluster(append([]kfake.Opt{kfake.NumBrokers(1)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cluster.Close)
+	return strings.Join(cluster.ListenAddrs(), ",")
+}
+
+func TestRunKafka(t *testing.T) {
+	brokers := newKafkaCluster(t)
+
+	yamlContents := []byte(fmt.Sprintf(`
+- name: Kafka
+  vars:
+    BROKERS: %s
+    TOPIC: coyote-test
+  entries:
+    - name: Create topic
+      kafka:
+        brokers: "%%BROKERS%%"
+        create_topic: { topic: "%%TOPIC%%", configs: { cleanup.policy: compact } }
+    - name: Topic exists
+      kafka:
+        brokers: "%%BROKERS%%"
+        create_topic: { topic: "%%TOPIC%%" }
+    - name: Produce
+      kafka:
+        brokers: "%%BROKERS%%"
+        produce:
+          topic: "%%TOPIC%%"
+          records:
+            - { key: a, value: '{"n": 1}', headers: { source: coyote } }
+            - { key: b, value: '{"n": 2}' }
+            - { key: c, value: '{"n": 3}' }
+      stdout:
+        - json:
+            - path: $[2].offset
+              equals: "2"
+    - name: Consume
+      kafka:
+        brokers: "%%BROKERS%%"
+        consume:
+          topic: "%%TOPIC%%"
+          group: coyote
+          expect:
+            - { key: ^a$, value: '"n": 1', headers: { source: ^coyote$ } }
+            - { key: ^b$ }
+            - { value: '"n": 3' }
+      stdout_has: [ '\{"topic":"coyote-test","partition":0,"offset":1,"key":"b"' ]
+      register:
+        - name: VALUE
+          json: $[0].value
+    - name: Consume more
+      kafka:
+        brokers: "%%BROKERS%%"
+        consume: { topic: "%%TOPIC%%", count: 5, timeout: 1s }
+    - name: Consume from offset
+      kafka:
+        brokers: "%%BROKERS%%"
+        consume: { topic: "%%TOPIC%%", partition: 0, offset: 2, expect: [ { value: "2" } ] }
+    - name: No lag
+      kafka:
+        brokers: "%%BROKERS%%"
+        lag: { group: coyote, max: 0 }
+    - name: Produce again
+      kafka:
+        brokers: "%%BROKERS%%"
+        produce: { topic: "%%TOPIC%%", records: [ { value: "%%VALUE%%" } ] }
+    - name: Lag
+      kafka:
+        brokers: "%%BROKERS%%"
+        lag: { group: coyote, topic: "%%TOPIC%%", max: 0 }
+      stdout_has: [ '"lag":1' ]
+    - name: Timeout
+      timeout: 500ms
+      kafka:
+        brokers: "%%BROKERS%%"
+        consume: { topic: "%%TOPIC%%", offset: latest }
+    - name: Delete topic
+      kafka:
+        brokers: "%%BROKERS%%"
+        delete_topic: { topic: "%%TOPIC%%" }`, brokers))
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ status, exit string }{
+		{"ok", "0"},
+		{"error", ""},
+		{"ok", "0"},
+		{"ok", "0"},
+		{"error", "consumed 3 of 5 records in 1s"},
+		{"error", `record 0: value '{"n": 3}' does not match '2'`},
+		{"ok", "0"},
+		{"ok", "0"},
+		{"error", "lag 1 of group 'coyote' is above 0"},
+		{"timeout", ""},
+		{"ok", "0"},
+	}
+	results := data.Results[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results but got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i].Status != e.status || (e.exit != "" && results[i].Exit != e.exit) {
+			t.Fatalf("[%d] expected status '%s' and exit '%s' but got '%s' and '%s': %s", i, e.status, e.exit,
+				results[i].Status, results[i].Exit, strings.Join(results[i].Stdout, "\n"))
+		}
+	}
+
+	if exit := results[1].Exit; !strings.Contains(exit, "TOPIC_ALREADY_EXISTS") {
+		t.Fatalf("expected the topic to exist but got '%s'", exit)
+	}
+	if command := results[2].Command; command != "kafka produce 3 records to coyote-test" {
+		t.Fatalf("expected the step to be described as a command but got '%s'", command)
+	}
+
+	cl, err := kgo.NewClient(kgo.SeedBrokers(brokers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	topics, err := kadm.NewClient(cl).ListTopics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topics.Has("coyote-test") {
+		t.Fatalf("expected the topic to be deleted but got %v", topics.Names())
+	}
+}
+
+func TestRunKafkaSecurity(t *testing.T) {
+	// The certificate of the test server is valid for 127.0.0.1, the address of the brokers.
+	tlsSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsSrv.Close()
+	dir := t.TempDir()
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw})
+	if err := ioutil.WriteFile(filepath.Join(dir, "ca.pem"), caCert, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saslBrokers := newKafkaCluster(t, kfake.EnableSASL(),
+		kfake.Superuser(KafkaPlain, "coyote", "secret"), kfake.Superuser(KafkaScramSHA256, "coyote", "secret"))
+	sslBrokers := newKafkaCluster(t, kfake.TLS(&tls.Config{Certificates: tlsSrv.TLS.Certificates}),
+		kfake.EnableSASL(), kfake.Superuser(KafkaScramSHA512, "coyote", "secret"))
+
+	yamlContents := []byte(fmt.Sprintf(`
+- name: Kafka security
+  vars:
+    SASL_BROKERS: %s
+    SSL_BROKERS: %s
+    PASSWORD: secret
+  entries:
+    - name: PLAIN
+      kafka:
+        brokers: "%%SASL_BROKERS%%"
+        security_protocol: SASL_PLAINTEXT
+        sasl_username: coyote
+        sasl_password: "%%PASSWORD%%"
+        create_topic: { topic: plain }
+    - name: SCRAM-SHA-256
+      kafka:
+        brokers: "%%SASL_BROKERS%%"
+        security_protocol: SASL_PLAINTEXT
+        sasl_mechanism: SCRAM-SHA-256
+        sasl_username: coyote
+        sasl_password: "%%PASSWORD%%"
+        create_topic: { topic: scram }
+    - name: Wrong password
+      timeout: 1s
+      kafka:
+        brokers: "%%SASL_BROKERS%%"
+        security_protocol: SASL_PLAINTEXT
+        sasl_mechanism: SCRAM-SHA-256
+        sasl_username: coyote
+        sasl_password: wrong
+        create_topic: { topic: wrong }
+    - name: SASL_SSL
+      workdir: %s
+      kafka:
+        brokers: "%%SSL_BROKERS%%"
+        security_protocol: SASL_SSL
+        sasl_mechanism: SCRAM-SHA-512
+        sasl_username: coyote
+        sasl_password: "%%PASSWORD%%"
+        tls: { ca_cert: ca.pem }
+        create_topic: { topic: ssl }
+    - name: Unknown authority
+      timeout: 5s
+      kafka:
+        brokers: "%%SSL_BROKERS%%"
+        security_protocol: SASL_SSL
+        sasl_mechanism: SCRAM-SHA-512
+        sasl_username: coyote
+        sasl_password: "%%PASSWORD%%"
+        create_topic: { topic: unknown }`, saslBrokers, sslBrokers, dir))
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The broker closes the connections that fail to authenticate, the client retries them until the timeout.
+	expected := []string{"ok", "ok", "timeout", "ok", "error"}
+	results := data.Results[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results but got %d", len(expected), len(results))
+	}
+	for i, status := range expected {
+		if results[i].Status != status {
+			t.Fatalf("[%d] expected status '%s' but got '%s' and '%s'", i, status, results[i].Status, results[i].Exit)
+		}
+	}
+	if !strings.Contains(results[4].Exit, "certificate") {
+		t.Fatalf("expected the certificate of the brokers to be rejected but got '%s'", results[4].Exit)
+	}
+}
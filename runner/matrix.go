@@ -0,0 +1,142 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"sort"
+	"strings"
+)
+
+// ExpandMatrix returns the "groups" with an instance of each group for every combination of the values of its `Matrix`,
+// and an instance of each entry for every combination of the values of its `Foreach`.
+// The instances are named after their values, i.e `Brokers [PROTOCOL=SASL_SSL]`,
+// and the values are vars of the instances. The groups that depend on a group with a matrix depend on all of its instances.
+//
+// The groups without a matrix and the entries without a foreach are returned as they are.
+func ExpandMatrix(groups []EntryGroup) []EntryGroup {
+	var (
+		expanded  []EntryGroup
+		instances = make(map[string][]string) // the names of the instances of the groups with a matrix.
+	)
+	for _, g := range groups {
+		g.Setup = expandForeach(g.Setup)
+		g.Entries = expandForeach(g.Entries)
+		g.Teardown = expandForeach(g.Teardown)
+
+		if len(g.Matrix) == 0 {
+			expanded = append(expanded, g)
+			continue
+		}
+
+		var names []string
+		for _, values := range combinations(g.Matrix) {
+			instance := g
+			instance.Name = instanceName(g.Name, values)
+			instance.Matrix = nil
+			instance.Vars = make(map[string]string, len(g.Vars)+len(values))
+			for k, v := range g.Vars {
+				instance.Vars[k] = v
+			}
+			for k, v := range values {
+				instance.Vars[k] = v
+			}
+
+			names = append(names, instance.Name)
+			expanded = append(expanded, instance)
+		}
+		instances[g.Name] = names
+	}
+
+	if len(instances) == 0 {
+		return expanded
+	}
+
+	for i, g := range expanded {
+		var dependsOn []string
+		for _, name := range g.DependsOn {
+			if names, ok := instances[name]; ok {
+				dependsOn = append(dependsOn, names...)
+				continue
+			}
+			dependsOn = append(dependsOn, name)
+		}
+		expanded[i].DependsOn = dependsOn
+	}
+	return expanded
+}
+
+// expandForeach returns the "entries" with an instance of each entry for every combination of the values of its `Foreach`.
+func expandForeach(entries []Entry) []Entry {
+	var expanded []Entry
+	for _, e := range entries {
+		if len(e.Foreach) == 0 {
+			expanded = append(expanded, e)
+			continue
+		}
+
+		name := e.Name
+		if name == "" {
+			name = strings.TrimSpace(e.Command)
+		}
+		for _, values := range combinations(e.Foreach) {
+			instance := e
+			instance.Name = instanceName(name, values)
+			instance.Foreach = nil
+			instance.vars = values
+			expanded = append(expanded, instance)
+		}
+	}
+	return expanded
+}
+
+// combinations returns every combination of the values of the "matrix", in the order of their values.
+// The values of the first name in alphabetical order change the slowest.
+func combinations(matrix map[string][]string) []map[string]string {
+	names := make([]string, 0, len(matrix))
+	for name := range matrix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	combos := []map[string]string{{}}
+	for _, name := range names {
+		var next []map[string]string
+		for _, combo := range combos {
+			for _, value := range matrix[name] {
+				values := make(map[string]string, len(combo)+1)
+				for k, v := range combo {
+					values[k] = v
+				}
+				values[name] = value
+				next = append(next, values)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// instanceName returns the name of the instance of a group or an entry with the "values", i.e `Brokers [PROTOCOL=SASL_SSL]`.
+func instanceName(name string, values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for i, k := range names {
+		names[i] = k + "=" + values[k]
+	}
+	return name + " [" + strings.Join(names, " ") + "]"
+}
@@ -0,0 +1,124 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExpandMatrix(t *testing.T) {
+	groups := ExpandMatrix([]EntryGroup{
+		{
+			Name:   "Brokers",
+			Vars:   map[string]string{"HOST": "localhost", "PORT": "9092"},
+			Matrix: map[string][]string{"PROTOCOL": {"SASL", "SSL"}, "PORT": {"9093", "9094"}},
+			Entries: []Entry{
+				{Name: "Produce", Foreach: map[string][]string{"TOPIC": {"a", "b"}}},
+				{Command: "echo %TOPIC%", Foreach: map[string][]string{"TOPIC": {"c"}}},
+			},
+		},
+		{Name: "Connect", DependsOn: []string{"Setup", "Brokers"}},
+	})
+
+	expected := []string{
+		"Brokers [PORT=9093 PROTOCOL=SASL]",
+		"Brokers [PORT=9093 PROTOCOL=SSL]",
+		"Brokers [PORT=9094 PROTOCOL=SASL]",
+		"Brokers [PORT=9094 PROTOCOL=SSL]",
+		"Connect",
+	}
+	if len(groups) != len(expected) {
+		t.Fatalf("expected %d groups but got %d", len(expected), len(groups))
+	}
+	for i, name := range expected {
+		if groups[i].Name != name {
+			t.Fatalf("[%d] expected the group '%s' but got '%s'", i, name, groups[i].Name)
+		}
+	}
+
+	if vars := groups[2].Vars; len(vars) != 3 || vars["HOST"] != "localhost" || vars["PORT"] != "9094" || vars["PROTOCOL"] != "SASL" {
+		t.Fatalf("expected the values of the matrix over the vars of the group but got %v", vars)
+	}
+
+	var entries []string
+	for _, e := range groups[0].Entries {
+		entries = append(entries, e.Name)
+	}
+	if got, expected := strings.Join(entries, ","), "Produce [TOPIC=a],Produce [TOPIC=b],echo %TOPIC% [TOPIC=c]"; got != expected {
+		t.Fatalf("expected the entries '%s' but got '%s'", expected, got)
+	}
+
+	if got := strings.Join(groups[4].DependsOn, ","); got != "Setup,"+strings.Join(expected[:4], ",") {
+		t.Fatalf("expected the group to depend on all the instances of the matrix but got '%s'", got)
+	}
+}
+
+func TestRunMatrix(t *testing.T) {
+	yamlContents := []byte(`
+- name: Clients
+  vars:
+    PROTOCOL: PLAINTEXT
+    TOPIC: default
+  matrix:
+    PROTOCOL: [ SASL, SSL ]
+  entries:
+    - name: Produce to %TOPIC%
+      command: echo "%PROTOCOL% %TOPIC%"
+      foreach:
+        TOPIC: [ a, b ]
+      stdout_has: [ "%PROTOCOL% %TOPIC%" ]
+      stdout:
+        - match: [ "^%PROTOCOL% %TOPIC%" ]
+    - command: echo "%PROTOCOL% %TOPIC%"
+      stdout_has: [ "%PROTOCOL% default" ]`)
+	if runtime.GOOS == "windows" {
+		yamlContents = bytes.Replace(yamlContents, []byte("echo"), []byte("cmd /C echo"), -1)
+	}
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"Clients [PROTOCOL=SASL]": {"Produce to a [TOPIC=a]", "Produce to b [TOPIC=b]", `echo "SASL default"`},
+		"Clients [PROTOCOL=SSL]":  {"Produce to a [TOPIC=a]", "Produce to b [TOPIC=b]", `echo "SSL default"`},
+	}
+	if len(data.Results) != len(expected) {
+		t.Fatalf("expected %d result groups but got %d", len(expected), len(data.Results))
+	}
+	for _, g := range data.Results {
+		names, ok := expected[g.Name]
+		if !ok {
+			t.Fatalf("unexpected group '%s'", g.Name)
+		}
+		for i, result := range g.Results {
+			if result.Status != "ok" {
+				t.Fatalf("[%s][%d] expected the values to be replaced but got: %s", g.Name, i, strings.Join(result.Stderr, "\n"))
+			}
+			if i < 2 && result.Name != names[i] {
+				t.Fatalf("[%s][%d] expected the entry '%s' but got '%s'", g.Name, i, names[i], result.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// spoolMemory is the size of an output kept in memory, a larger output is spooled to a temporary file.
+const spoolMemory = 1 << 20
+
+// output is the stdout or the stderr of a command. The assertions read it as a stream,
+// so a huge output never has to fit in memory. A `strings.Reader` is an output too.
+type output interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// readerOf returns a reader of the whole output "o".
+func readerOf(o output) *bufio.Reader {
+	return bufio.NewReader(io.NewSectionReader(o, 0, o.Size()))
+}
+
+// readAll reads the whole output "o" in memory.
+func readAll(o output) (string, error) {
+	b, err := ioutil.ReadAll(io.NewSectionReader(o, 0, o.Size()))
+	return string(b), err
+}
+
+// matchOutput reports whether the output "o" matches the regex expression "expr",
+// or contains "expr" if "literal" is true.
+func matchOutput(expr string, o output, literal bool) (bool, error) {
+	if literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchReader(readerOf(o)), nil
+}
+
+// equalOutput reports whether the output "o" equals "s", the trailing new lines of both are ignored.
+func equalOutput(s string, o output) bool {
+	s = removeNewLine(s)
+	if o.Size() < int64(len(s)) {
+		return false
+	}
+
+	r := readerOf(o)
+	head := make([]byte, len(s))
+	if _, err := io.ReadFull(r, head); err != nil || string(head) != s {
+		return false
+	}
+	// Only new lines may follow.
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err == io.EOF
+		}
+		if c != '\r' && c != '\n' {
+			return false
+		}
+	}
+}
+
+// spool captures an output of a command. It keeps the output in memory
+// until it grows past `spoolMemory`, then moves it to a temporary file.
+// It may be read while the command still writes, i.e by the ready probe of a background entry.
+// It must be closed to remove the file.
+type spool struct {
+	mu   sync.Mutex // protects all the fields.
+	buf  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil && int64(s.buf.Len()+len(p)) > spoolMemory {
+		f, err := ioutil.TempFile("", "coyote-output-")
+		if err != nil {
+			return 0, err
+		}
+		if _, err = f.Write(s.buf.Bytes()); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return 0, err
+		}
+		s.file, s.buf = f, bytes.Buffer{}
+	}
+
+	var (
+		n   int
+		err error
+	)
+	if s.file != nil {
+		n, err = s.file.Write(p)
+	} else {
+		n, err = s.buf.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// ReadAt reads the captured output.
+func (s *spool) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		return s.file.ReadAt(p, off)
+	}
+	return bytes.NewReader(s.buf.Bytes()).ReadAt(p, off)
+}
+
+// Size returns the size of the captured output.
+func (s *spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Close removes the temporary file of the output, if any.
+func (s *spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	err := os.Remove(s.file.Name())
+	s.file = nil
+	return err
+}
+
+// text returns the captured output to keep in the results. If the output is larger than "max" bytes
+// only its head and its tail are kept, up to half of "max" each and cut at whole lines where possible.
+// A zero "max" keeps the whole output.
+func (s *spool) text(max int64) string {
+	size := s.Size()
+	if max <= 0 || size <= max {
+		text, _ := readAll(s)
+		return text
+	}
+
+	head := make([]byte, max/2)
+	n, _ := s.ReadAt(head, 0)
+	head = head[:n]
+	if i := bytes.LastIndexByte(head, '\n'); i >= 0 {
+		head = head[:i+1]
+	}
+
+	tail := make([]byte, max-max/2)
+	n, _ = s.ReadAt(tail, size-int64(len(tail)))
+	tail = tail[:n]
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+
+	truncated := size - int64(len(head)+len(tail))
+	if len(head) > 0 && head[len(head)-1] == '\n' {
+		return fmt.Sprintf("%s... %d bytes truncated ...\n%s", head, truncated, tail)
+	}
+	return fmt.Sprintf("%s\n... %d bytes truncated ...\n%s", head, truncated, tail)
+}
+
+// save writes the whole captured output to the file "name".
+func (s *spool) save(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, io.NewSectionReader(s, 0, s.Size())); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ByteSize is a size in bytes, e.g `max_output: 64KB`. It is set by a number of bytes
+// or by a number followed by one of the units B, KB, MB and GB, which are multiples of 1024.
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   ByteSize
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}}
+
+// ParseByteSize parses a size in bytes, e.g "1048576", "512KB" or "1MB".
+func ParseByteSize(s string) (ByteSize, error) {
+	value, unit := strings.ToUpper(strings.TrimSpace(s)), ByteSize(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value, unit = strings.TrimSpace(strings.TrimSuffix(value, u.suffix)), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size '%s', expected a number of bytes optionally followed by KB, MB or GB", s)
+	}
+	return ByteSize(n) * unit, nil
+}
+
+// UnmarshalYAML accepts a number of bytes as well as a size with a unit.
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// String returns the size in bytes.
+func (b ByteSize) String() string {
+	return strconv.FormatInt(int64(b), 10)
+}
+
+// Set parses the size "s", so a `ByteSize` may be used as a command line flag.
+func (b *ByteSize) Set(s string) error {
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	s := new(spool)
+	defer s.Close()
+
+	line := strings.Repeat("x", 1023) + "\n"
+	s.Write([]byte("first\n"))
+	for i := 0; i < 2048; i++ {
+		s.Write([]byte(line))
+	}
+	s.Write([]byte("last\n"))
+
+	if s.file == nil {
+		t.Fatalf("expected an output of %d bytes to be spooled to a file", s.Size())
+	}
+	name := s.file.Name()
+
+	if expected := int64(len("first\n") + 2048*len(line) + len("last\n")); s.Size() != expected {
+		t.Fatalf("expected size %d but got %d", expected, s.Size())
+	}
+
+	for _, expr := range []string{"^first", "last\n$", "x{1000}\n"} {
+		if pass, err := matchOutput(expr, s, false); err != nil || !pass {
+			t.Fatalf("expected the output to match '%s' (%v)", expr, err)
+		}
+	}
+	if pass, _ := matchOutput("first.last", s, false); pass {
+		t.Fatalf("expected the output to not match")
+	}
+
+	text := s.text(20)
+	if expected := "first\n... 2097152 bytes truncated ...\nlast\n"; text != expected {
+		t.Fatalf("expected the head and the tail of the output '%s' but got '%s'", expected, text)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("expected the spool file to be removed but got %v", err)
+	}
+}
+
+func TestEqualOutput(t *testing.T) {
+	tests := []struct {
+		against, output string
+		expected        bool
+	}{
+		{"hello", "hello", true},
+		{"hello\n", "hello\r\n\n", true},
+		{"hello", "hello world", false},
+		{"hello", "hell", false},
+		{"", "\n", true},
+	}
+
+	for i, tt := range tests {
+		if got := equalOutput(tt.against, strings.NewReader(tt.output)); got != tt.expected {
+			t.Fatalf("[%d] expected %t for '%s' against '%s' but got %t", i, tt.expected, tt.output, tt.against, got)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected ByteSize
+		fail     bool
+	}{
+		{size: "1024", expected: 1024},
+		{size: "64KB", expected: 64 << 10},
+		{size: "1 mb", expected: 1 << 20},
+		{size: "2G", expected: 2 << 30},
+		{size: "10B", expected: 10},
+		{size: "1TB", fail: true},
+		{size: "-1", fail: true},
+	}
+
+	for i, tt := range tests {
+		got, err := ParseByteSize(tt.size)
+		if tt.fail {
+			if err == nil {
+				t.Fatalf("[%d] expected '%s' to fail but got %d", i, tt.size, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("[%d] %v", i, err)
+		}
+		if got != tt.expected {
+			t.Fatalf("[%d] expected %d for '%s' but got %d", i, tt.expected, tt.size, got)
+		}
+	}
+}
+
+func TestRunEntryMaxOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the seq command")
+	}
+
+	yamlContents := []byte(`
+- name: Output
+  entries:
+    - name: Count
+      command: seq 1 100000
+      max_output: 24
+      stdout:
+        - match: [ "^1\n2\n", "\n50000\n", "100000\n$" ]
+      register:
+        - name: LAST
+          regex: "\n(99999)\n"`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	data, err := Run(context.Background(), groups, Options{ArtifactsDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := data.Results[0].Results[0]
+	if result.Status != "ok" {
+		t.Fatalf("expected the assertions to see the whole output but got: %s", strings.Join(result.Stderr, "\n"))
+	}
+
+	expected := []string{"1", "2", "3", "4", "5", "6", "... 588876 bytes truncated ...", "100000", ""}
+	if got := strings.Join(result.Stdout, "|"); got != strings.Join(expected, "|") {
+		t.Fatalf("expected the head and the tail of the output '%s' but got '%s'", strings.Join(expected, "|"), got)
+	}
+
+	if expected := filepath.Join(dir, "0001-Count.stdout.log"); result.StdoutFile != expected || result.StderrFile != "" {
+		t.Fatalf("expected the stdout to be saved as '%s' but got '%s' and '%s'", expected, result.StdoutFile, result.StderrFile)
+	}
+	b, err := ioutil.ReadFile(result.StdoutFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 588895 {
+		t.Fatalf("expected the whole output to be saved but got %d bytes", len(b))
+	}
+}
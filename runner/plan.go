@@ -0,0 +1,327 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	shellwords "github.com/mattn/go-shellwords"
+)
+
+type (
+	// PlanEntry is an entry the way it would run, with its variables replaced.
+	PlanEntry struct {
+		Name       string
+		Command    string
+		Args       []string
+		WorkDir    string   `json:",omitempty"`
+		Env        []string `json:",omitempty"`
+		Stdin      string   `json:",omitempty"`
+		Timeout    string
+		Assertions []string `json:",omitempty"`
+	}
+
+	// PlanGroup is a group that would run and its entries, see the `-dry-run` flag.
+	PlanGroup struct {
+		Name    string
+		Title   string      `json:",omitempty"`
+		Setup   []PlanEntry `json:",omitempty"`
+		Entries []PlanEntry
+		// Teardown runs last, even if the setup or the entries fail.
+		Teardown []PlanEntry `json:",omitempty"`
+	}
+)
+
+// Plan returns the groups and entries that would run, in the order they would run,
+// without running anything. Skipped groups and entries are left out.
+func Plan(groups []EntryGroup, opts Options) ([]PlanGroup, error) {
+	groups, err := SortGroups(ExpandMatrix(groups))
+	if err != nil {
+		return nil, err
+	}
+	r, err := New(groups, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []PlanGroup
+	for _, g := range groups {
+		// Reserved name coyote is used to set the title and global vars.
+		if g.Name == "coyote" {
+			continue
+		}
+
+		localVars, _ := checkVarNames(g.Vars)
+		if reason := r.groupSkipReason(g); reason != "" {
+			r.opts.Logger.Printf("Skipping processing group: [ %s ], %s\n", g.Name, reason)
+			continue
+		}
+
+		plan = append(plan, PlanGroup{
+			Name:     g.Name,
+			Title:    replaceVars(g.Title, localVars, r.getGlobalVars()),
+			Setup:    r.planEntries(g.Setup, localVars),
+			Entries:  r.planEntries(g.Entries, localVars),
+			Teardown: r.planEntries(g.Teardown, localVars),
+		})
+	}
+
+	return plan, nil
+}
+
+// planEntries returns the "entries" that would run with the "localVars" of their group, skipped ones are left out.
+func (r *Runner) planEntries(entries []Entry, localVars map[string]string) []PlanEntry {
+	var plan []PlanEntry
+	for _, e := range entries {
+		if e.SkipReason() != "" {
+			continue
+		}
+
+		r.prepare(&e, localVars)
+		// Stops and steps are described by their command, only real commands have args.
+		var args []string
+		if e.Stop != "" {
+			e.Command = "stop " + e.Stop
+		} else if s := e.step(); s != nil {
+			e.Command = s.String()
+		} else {
+			var err error
+			if args, err = shellwords.Parse(e.Command); err != nil {
+				r.opts.Logger.Printf("Error when parsing command [ %s ] for [ %s ]\n", e.Command, e.Name)
+			}
+		}
+
+		plan = append(plan, PlanEntry{
+			Name:       e.Name,
+			Command:    e.Command,
+			Args:       args,
+			WorkDir:    e.WorkDir,
+			Env:        e.EnvVars,
+			Stdin:      e.Stdin,
+			Timeout:    e.Timeout.String(),
+			Assertions: e.describeAssertions(),
+		})
+	}
+
+	return plan
+}
+
+// describeAssertions returns the expectations of the entry in a human readable form.
+func (e *Entry) describeAssertions() []string {
+	var assertions []string
+	add := func(format string, args ...interface{}) {
+		assertions = append(assertions, fmt.Sprintf(format, args...))
+	}
+
+	for _, v := range e.StdoutExpect {
+		add("stdout_has: %s", strconv.Quote(v))
+	}
+	for _, v := range e.StdoutNotExpect {
+		add("stdout_not_has: %s", strconv.Quote(v))
+	}
+	for _, v := range e.StderrExpect {
+		add("stderr_has: %s", strconv.Quote(v))
+	}
+	for _, v := range e.StderrNotExpect {
+		add("stderr_not_has: %s", strconv.Quote(v))
+	}
+
+	for _, o := range []struct {
+		output  string
+		filters OutFilters
+	}{{"stdout", e.Stdout}, {"stderr", e.Stderr}} {
+		for i, f := range o.filters {
+			for _, v := range f.Match {
+				add("%s[%d] match: %s", o.output, i, strconv.Quote(v))
+			}
+			for _, v := range f.NotMatch {
+				add("%s[%d] not_match: %s", o.output, i, strconv.Quote(v))
+			}
+			for _, a := range f.JSON {
+				add("%s[%d] json: %s", o.output, i, a.describe())
+			}
+		}
+	}
+
+	if h := e.HTTP; h != nil {
+		if len(h.Status) > 0 {
+			add("http status: %s", h.Status)
+		} else {
+			add("http status: below 400")
+		}
+		names := make([]string, 0, len(h.ResponseHeaders))
+		for name := range h.ResponseHeaders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add("http header %s: %s", name, strconv.Quote(h.ResponseHeaders[name]))
+		}
+	}
+	if k := e.Kafka; k != nil {
+		if c := k.Consume; c != nil {
+			add("kafka records: %d", c.count())
+			for i, m := range c.Expect {
+				if m.Key != "" {
+					add("kafka record[%d] key: %s", i, strconv.Quote(m.Key))
+				}
+				if m.Value != "" {
+					add("kafka record[%d] value: %s", i, strconv.Quote(m.Value))
+				}
+				names := make([]string, 0, len(m.Headers))
+				for name := range m.Headers {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					add("kafka record[%d] header %s: %s", i, name, strconv.Quote(m.Headers[name]))
+				}
+			}
+		}
+		if l := k.Lag; l != nil && l.Max != nil {
+			add("kafka lag: at most %d", *l.Max)
+		}
+	}
+	if s := e.SchemaRegistry; s != nil {
+		switch {
+		case s.Register != nil && s.Register.CompatibleWith != "":
+			add("schema registry compatible with: %s version %s", s.Register.Subject, s.Register.compatibleWith())
+		case s.CheckCompatibility != nil:
+			add("schema registry compatible with: %s version %s", s.CheckCompatibility.Subject, s.CheckCompatibility.compatibleWith())
+		}
+		for _, subject := range s.SubjectExists {
+			add("schema registry subject exists: %s", subject)
+		}
+	}
+	if c := e.Connect; c != nil && c.State != "" {
+		add("connect state: %s", strings.ToUpper(c.State))
+	}
+
+	switch {
+	case e.IgnoreExitCode:
+		add("exit code: ignored")
+	case e.Signal != "":
+		add("signal: %s", e.Signal)
+	case len(e.ExitCode) > 0:
+		add("exit code: %s", e.ExitCode)
+	default:
+		add("exit code: 0")
+	}
+
+	if e.Retries > 0 {
+		interval := e.RetryInterval
+		if interval <= 0 {
+			interval = time.Second
+		}
+		add("retries: %d every %s", e.Retries, interval)
+	}
+
+	for _, r := range e.Register {
+		add("register: %s", r.Name)
+	}
+
+	if e.Background {
+		add("background: id %s", strconv.Quote(e.ID))
+		if p := e.Ready; p != nil {
+			add("ready: stdout %s, tcp %s, http %s", strconv.Quote(p.Stdout), strconv.Quote(p.TCP), strconv.Quote(p.HTTP))
+		}
+	}
+
+	return assertions
+}
+
+// describe returns the expectations of the assertion, i.e `$.state equals "RUNNING"`.
+func (a JSONAssertion) describe() string {
+	parts := []string{a.Path}
+	if a.Exists != nil {
+		parts = append(parts, fmt.Sprintf("exists %v", *a.Exists))
+	}
+	if a.Equals != nil {
+		parts = append(parts, fmt.Sprintf("equals %s", strconv.Quote(jsonValueString(yamlToJSON(a.Equals)))))
+	}
+	if a.Match != "" {
+		parts = append(parts, fmt.Sprintf("match %s", strconv.Quote(a.Match)))
+	}
+	if a.Length != nil {
+		parts = append(parts, fmt.Sprintf("length %d", *a.Length))
+	}
+	if a.GT != nil {
+		parts = append(parts, fmt.Sprintf("gt %v", *a.GT))
+	}
+	if a.GTE != nil {
+		parts = append(parts, fmt.Sprintf("gte %v", *a.GTE))
+	}
+	if a.LT != nil {
+		parts = append(parts, fmt.Sprintf("lt %v", *a.LT))
+	}
+	if a.LTE != nil {
+		parts = append(parts, fmt.Sprintf("lte %v", *a.LTE))
+	}
+	return strings.Join(parts, " ")
+}
+
+// WritePlan writes the "plan" to "w" as text or json, based on the "format".
+func WritePlan(w io.Writer, plan []PlanGroup, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	case "text":
+	default:
+		return fmt.Errorf("unknown dry run format '%s', expected text or json", format)
+	}
+
+	b := new(strings.Builder)
+	for _, g := range plan {
+		fmt.Fprintf(b, "[ %s ]\n", g.Name)
+		writePlanEntries(b, "setup: ", g.Setup)
+		writePlanEntries(b, "", g.Entries)
+		writePlanEntries(b, "teardown: ", g.Teardown)
+		fmt.Fprintln(b)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writePlanEntries writes the "entries" of a group in text, their names start with the "prefix".
+func writePlanEntries(b *strings.Builder, prefix string, entries []PlanEntry) {
+	for _, e := range entries {
+		fmt.Fprintf(b, "  - %s%s\n", prefix, e.Name)
+		fmt.Fprintf(b, "    command: %s\n", strings.Replace(strings.TrimSpace(e.Command), "\n", "\n      ", -1))
+		if e.WorkDir != "" {
+			fmt.Fprintf(b, "    workdir: %s\n", e.WorkDir)
+		}
+		for _, env := range e.Env {
+			fmt.Fprintf(b, "    env: %s\n", env)
+		}
+		if e.Stdin != "" {
+			fmt.Fprintf(b, "    stdin: %s\n", strconv.Quote(e.Stdin))
+		}
+		fmt.Fprintf(b, "    timeout: %s\n", e.Timeout)
+		for _, a := range e.Assertions {
+			fmt.Fprintf(b, "    assert: %s\n", a)
+		}
+	}
+}
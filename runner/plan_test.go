@@ -0,0 +1,99 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPlanGroups(t *testing.T) {
+	yamlContents := []byte(`
+- name: Brokers
+  vars:
+    TOPIC: coyote_test
+  entries:
+    - name: Create %TOPIC%
+      command: kafka-topics --topic %TOPIC%_%UNIQUE_T% --create
+      workdir: /tmp
+      env: [ KAFKA_OPTS=-Xmx1g ]
+      stdin: hello
+      timeout: 30s
+      stdout_has: [ "Created" ]
+      exit_code: "!2"
+    - name: Quoted url
+      http:
+        url: "http://localhost/it's"
+    - name: skipped entry
+      command: "false"
+      skip: true
+
+- name: Skipped
+  noskip: _skipped_
+  entries:
+    - command: "false"
+
+- name: Filtered out
+  entries:
+    - command: "false"`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := Plan(groups, Options{Filter: regexp.MustCompile("Brokers|Skipped")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || len(plan[0].Entries) != 2 {
+		t.Fatalf("expected a single group with two entries but got %#v", plan)
+	}
+
+	e := plan[0].Entries[0]
+	if e.Name != "Create coyote_test" || !regexp.MustCompile(`^kafka-topics --topic coyote_test_[0-9]+ --create$`).MatchString(e.Command) {
+		t.Fatalf("expected variables to be replaced but got name '%s' and command '%s'", e.Name, e.Command)
+	}
+	if len(e.Args) != 4 || e.WorkDir != "/tmp" || e.Stdin != "hello" || e.Timeout != "30s" || e.Env[0] != "KAFKA_OPTS=-Xmx1g" {
+		t.Fatalf("unexpected entry: %#v", e)
+	}
+	if e := plan[0].Entries[1]; e.Command != "GET http://localhost/it's" || e.Args != nil {
+		t.Fatalf("expected the request to be described but not parsed but got %#v", e)
+	}
+
+	text := new(strings.Builder)
+	if err := WritePlan(text, plan, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"[ Brokers ]", "  - Create coyote_test", "    workdir: /tmp", `    assert: stdout_has: "Created"`, "    assert: exit code: !2"} {
+		if !strings.Contains(text.String(), expected) {
+			t.Fatalf("expected text plan to contain '%s' but got:\n%s", expected, text)
+		}
+	}
+
+	b := new(strings.Builder)
+	if err := WritePlan(b, plan, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []PlanGroup
+	if err := json.Unmarshal([]byte(b.String()), &decoded); err != nil || decoded[0].Entries[0].Command != e.Command {
+		t.Fatalf("expected json plan to decode to the same plan: %v\n%s", err, b)
+	}
+
+	if err := WritePlan(b, plan, "yaml"); err == nil {
+		t.Fatalf("expected unknown format to fail")
+	}
+}
@@ -11,35 +11,26 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+//go:build !windows
+// +build !windows
 
-type Result struct {
-	Name    string
-	Command string
-	Status  string
-	Time    float64
-	Stdout  []string
-	Stderr  []string
-	Exit    string
-	Test    Entry
-}
+package runner
+
+import (
+	"os/exec"
+	"syscall"
+)
 
-type ResultGroup struct {
-	Name      string
-	Type      string
-	Results   []Result
-	Passed    int
-	Errors    int
-	Total     int
-	TotalTime float64
+// setProcessGroup starts the command in its own process group,
+// so the processes it spawns can be signaled together with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
 }
 
-type ExportData struct {
-	Results    []ResultGroup
-	Errors     int
-	Successful int
-	TotalTests int
-	TotalTime  float64
-	Date       string
-	Title      string
+// signalProcessGroup sends "sig" to the started command and all its descendants.
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig)
 }
@@ -0,0 +1,140 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+type (
+	// Register describes a value to capture from the output of an entry
+	// and store as a variable, so the next entries can use it as `%NAME%`.
+	//
+	// Without `Regex` and `JSON` the whole (trimmed) output is stored.
+	Register struct {
+		// Name is the variable name, without the enclosing percent signs.
+		Name string `yaml:"name"`
+		// From is the output to extract from, "stdout" (default) or "stderr".
+		From string `yaml:"from,omitempty"`
+		// Regex extracts the first capture group, or the whole match if the expression has no groups.
+		Regex string `yaml:"regex,omitempty"`
+		// JSON extracts the value under a json path, e.g `$.tasks[0].id`.
+		JSON string `yaml:"json,omitempty"`
+		// Scope is "local" (default) to store the variable in the group's vars
+		// or "global" to make it available to all the groups that run afterwards.
+		Scope string `yaml:"scope,omitempty"`
+	}
+
+	// Registers is a set of `Register`.
+	Registers []Register
+)
+
+// extract returns the value described by "r" from the command's outputs.
+func (r Register) extract(stdout, stderr output) (string, error) {
+	o := stdout
+	switch strings.ToLower(r.From) {
+	case "", "stdout":
+	case "stderr":
+		o = stderr
+	default:
+		return "", fmt.Errorf("register '%s': unknown output '%s', expected stdout or stderr", r.Name, r.From)
+	}
+
+	switch {
+	case r.Regex != "" && r.JSON != "":
+		return "", fmt.Errorf("register '%s': only one of regex and json may be set", r.Name)
+	case r.Regex != "":
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return "", fmt.Errorf("register '%s': bad regexp: %v", r.Name, err)
+		}
+		loc := re.FindReaderSubmatchIndex(readerOf(o))
+		if loc == nil {
+			return "", fmt.Errorf("register '%s': regex '%s' did not match", r.Name, r.Regex)
+		}
+		if len(loc) > 2 {
+			loc = loc[2:]
+		}
+		if loc[0] < 0 { // the group did not participate in the match.
+			return "", nil
+		}
+		value := make([]byte, loc[1]-loc[0])
+		if _, err := o.ReadAt(value, int64(loc[0])); err != nil && err != io.EOF {
+			return "", fmt.Errorf("register '%s': %v", r.Name, err)
+		}
+		return string(value), nil
+	case r.JSON != "":
+		doc, err := decodeJSON(o)
+		if err != nil {
+			return "", fmt.Errorf("register '%s': %v", r.Name, err)
+		}
+		value, exists, err := lookupJSONPath(doc, r.JSON)
+		if err != nil {
+			return "", fmt.Errorf("register '%s': %v", r.Name, err)
+		}
+		if !exists {
+			return "", fmt.Errorf("register '%s': json path '%s' not found", r.Name, r.JSON)
+		}
+		return jsonValueString(value), nil
+	default:
+		value, err := readAll(o)
+		if err != nil {
+			return "", fmt.Errorf("register '%s': %v", r.Name, err)
+		}
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// Apply extracts every register from the outputs and stores the values
+// as local (inside "localVars") or global variables (through "setGlobalVar").
+// It keeps going on failures and returns all of them as a single error.
+func (registers Registers) Apply(stdout, stderr string, localVars map[string]string, setGlobalVar func(name, value string)) error {
+	return registers.apply(strings.NewReader(stdout), strings.NewReader(stderr), localVars, setGlobalVar)
+}
+
+// apply is the `Apply` of the outputs of a command, which may be spooled to files.
+func (registers Registers) apply(stdout, stderr output, localVars map[string]string, setGlobalVar func(name, value string)) error {
+	var errMsg string
+
+	for _, r := range registers {
+		if _, err := checkVarNames(map[string]string{r.Name: ""}); err != nil {
+			errMsg += fmt.Sprintf("register: %v\n", err)
+			continue
+		}
+
+		value, err := r.extract(stdout, stderr)
+		if err != nil {
+			errMsg += err.Error() + "\n"
+			continue
+		}
+
+		switch strings.ToLower(r.Scope) {
+		case "", "local":
+			localVars["%"+r.Name+"%"] = value
+		case "global":
+			setGlobalVar(r.Name, value)
+		default:
+			errMsg += fmt.Sprintf("register '%s': unknown scope '%s', expected local or global\n", r.Name, r.Scope)
+		}
+	}
+
+	if errMsg != "" {
+		return errors.New(errMsg)
+	}
+	return nil
+}
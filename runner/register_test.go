@@ -0,0 +1,108 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRegisterExtract(t *testing.T) {
+	stdout := `{"name":"sink","tasks":[{"id":0,"state":"RUNNING"}],"config":{"tasks.max":"1"},"offset":9007199254740993,"ratio":1.50}`
+
+	tests := []struct {
+		register Register
+		expected string
+		fail     bool
+	}{
+		{register: Register{Name: "WHOLE", From: "stderr"}, expected: "consumer-1"},
+		{register: Register{Name: "RE", Regex: `"name":"([a-z]+)"`}, expected: "sink"},
+		{register: Register{Name: "RE_NO_GROUP", Regex: `RUN+ING`}, expected: "RUNNING"},
+		{register: Register{Name: "JSON", JSON: "$.tasks[0].state"}, expected: "RUNNING"},
+		{register: Register{Name: "JSON_DOTS", JSON: "tasks.0.id"}, expected: "0"},
+		{register: Register{Name: "JSON_QUOTED", JSON: `$.config["tasks.max"]`}, expected: "1"},
+		{register: Register{Name: "JSON_OBJECT", JSON: "$.tasks[-1]"}, expected: `{"id":0,"state":"RUNNING"}`},
+		{register: Register{Name: "JSON_BIG_INT", JSON: "$.offset"}, expected: "9007199254740993"},
+		{register: Register{Name: "JSON_FLOAT", JSON: "$.ratio"}, expected: "1.5"},
+		{register: Register{Name: "JSON_MISSING", JSON: "$.tasks[1].state"}, fail: true},
+		{register: Register{Name: "RE_MISSING", Regex: "FAILED"}, fail: true},
+		{register: Register{Name: "BAD_FROM", From: "stdin"}, fail: true},
+	}
+
+	for i, tt := range tests {
+		got, err := tt.register.extract(strings.NewReader(stdout), strings.NewReader("\n consumer-1\n"))
+		if tt.fail {
+			if err == nil {
+				t.Fatalf("[%d] register '%s' expected to fail but got '%s'", i, tt.register.Name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("[%d] register '%s' failed: %v", i, tt.register.Name, err)
+		}
+		if got != tt.expected {
+			t.Fatalf("[%d] register '%s' expected '%s' but got '%s'", i, tt.register.Name, tt.expected, got)
+		}
+	}
+}
+
+func TestRegisterNextEntry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the echo command")
+	}
+
+	yamlContents := []byte(`
+- name: Register
+  entries:
+    - name: create
+      command: echo "id=coyote-42"
+      register:
+        - name: CONNECTOR_ID
+          regex: 'id=([a-z0-9-]+)'
+        - name: SHARED_ID
+          regex: '[0-9]+'
+          scope: global
+    - name: use
+      command: echo "%CONNECTOR_ID% %SHARED_ID%"
+      stdout:
+        - match: ["^coyote-42 42"]
+    - name: missing
+      command: echo "nothing"
+      register:
+        - name: NOT_THERE
+          regex: 'id=(.+)'`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRunner(t, groups, Options{})
+	results := r.runGroups(context.Background(), groups)
+	if len(results) != 1 {
+		t.Fatalf("expected a single result group but got %d", len(results))
+	}
+
+	for i, status := range []string{"ok", "ok", "error"} {
+		if got := results[0].Results[i].Status; got != status {
+			t.Fatalf("[%d] expected status '%s' but got '%s': %v", i, status, got, results[0].Results[i].Stderr)
+		}
+	}
+
+	if got := r.getGlobalVars()["%SHARED_ID%"]; got != "42" {
+		t.Fatalf("expected global var to be registered but got '%s'", got)
+	}
+}
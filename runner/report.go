@@ -0,0 +1,103 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"strings"
+)
+
+// ReportOptions configure the html report, see `WriteHTML`.
+type ReportOptions struct {
+	// Template is the template of the report, defaults to the built-in one, see `NewTemplate`.
+	Template *template.Template
+	// SelfContained if true includes the scripts and stylesheets of the report inside it,
+	// so it opens from disk without a web server.
+	SelfContained bool
+	// Generator is written as a comment inside the report, i.e "Coyote v1.5", defaults to "Coyote".
+	Generator string
+	// Logger if not nil receives the scripts and stylesheets that could not be included.
+	Logger *log.Logger
+}
+
+// NewTemplate parses the "text" of a report template, its delimiters are "<{=(" and ")=}>".
+// An empty "text" returns the built-in template.
+func NewTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = mainTemplate
+	}
+	return template.New("").Delims("<{=(", ")=}>").Parse(text)
+}
+
+// WriteJSON writes the "data" to "w" in json.
+func WriteJSON(w io.Writer, data ExportData) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return errors.New("Coyote error when creating json.")
+	}
+
+	_, err = w.Write(jsonData)
+	return err
+}
+
+// WriteHTML writes the "data" to "w" as an html report.
+func WriteHTML(w io.Writer, data ExportData, opts ReportOptions) error {
+	t := opts.Template
+	if t == nil {
+		var err error
+		if t, err = NewTemplate(""); err != nil {
+			return err
+		}
+	}
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return errors.New("Coyote error when creating json.")
+	}
+
+	generator := opts.Generator
+	if generator == "" {
+		generator = "Coyote"
+	}
+
+	templateVars := struct {
+		Data    template.JS
+		Version template.HTML
+	}{
+		template.JS(jsonData),
+		template.HTML("<!-- Generated by " + template.HTMLEscapeString(generator) + ". -->"),
+	}
+
+	h := &bytes.Buffer{}
+	if err = t.Execute(h, templateVars); err != nil {
+		return err
+	}
+
+	if !opts.SelfContained {
+		_, err = w.Write(h.Bytes())
+		return err
+	}
+
+	report, missing := inlineAssets(h.String(), templateAssets())
+	if len(missing) > 0 && opts.Logger != nil {
+		opts.Logger.Printf("The report needs network access to load: %s\n", strings.Join(missing, ", "))
+	}
+	_, err = io.WriteString(w, report)
+	return err
+}
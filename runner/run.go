@@ -0,0 +1,831 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	shellwords "github.com/mattn/go-shellwords"
+)
+
+// runGroups executes the "groups", sorted by their dependencies, and returns their results in the same order.
+//
+// Groups marked as `parallel` run concurrently with their neighbouring parallel groups,
+// up to "workers" at a time, once the groups they depend on are done. Any other group waits for the in-flight groups to finish
+// and then runs alone, so suites that rely on file order keep working.
+// A group is skipped if a group it depends on failed or did not run to the end.
+// Once "ctx" is done the remaining groups
+// do not start, their entries are marked as not run.
+func (r *Runner) runGroups(ctx context.Context, groups []EntryGroup) []ResultGroup {
+	var (
+		workers = r.opts.Parallel
+		results = make([]ResultGroup, len(groups))
+		ran     = make([]bool, len(groups))
+		sem     = make(chan struct{}, workers)
+		wg      sync.WaitGroup
+
+		index    = make(map[string]int, len(groups))
+		done     = make([]chan struct{}, len(groups)) // closed once the group and its "failures" are set.
+		failures = make([]string, len(groups))        // why the groups that depend on a group are skipped, if they are.
+	)
+	for i, group := range groups {
+		index[group.Name] = i
+		done[i] = make(chan struct{})
+	}
+
+	// run waits for the dependencies of the group "i" and runs it.
+	run := func(i int, group EntryGroup) {
+		defer close(done[i])
+
+		depsReason := ""
+		for _, name := range group.DependsOn {
+			j := index[name]
+			<-done[j]
+			if depsReason == "" {
+				depsReason = failures[j]
+			}
+		}
+
+		if r.opts.GroupHook == nil || group.Name == "coyote" {
+			results[i], ran[i] = r.runGroup(ctx, group, depsReason, nil)
+		} else {
+			r.opts.GroupHook(group, func(hook EntryHook) ResultGroup {
+				results[i], ran[i] = r.runGroup(ctx, group, depsReason, hook)
+				return results[i]
+			})
+		}
+		switch {
+		case depsReason != "":
+			failures[i] = depsReason
+		case results[i].Errors > 0 || results[i].FixtureErrors > 0:
+			failures[i] = fmt.Sprintf("dependency failed: group '%s'", group.Name)
+		case !completed(results[i]):
+			failures[i] = fmt.Sprintf("dependency not run: group '%s'", group.Name)
+		}
+	}
+
+	for i, group := range groups {
+		if !group.Parallel || workers == 1 || ctx.Err() != nil {
+			wg.Wait()
+			run(i, group)
+			continue
+		}
+
+		// The groups take a worker in order, so the dependencies of a group always took theirs before it.
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, group EntryGroup) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			run(i, group)
+		}(i, group)
+	}
+	wg.Wait()
+
+	var resultsGroups []ResultGroup
+	for i, resultGroup := range results {
+		if ran[i] {
+			resultsGroups = append(resultsGroups, resultGroup)
+		}
+	}
+
+	return resultsGroups
+}
+
+// skipReason returns why a group or an entry should be skipped based on its `skip` and `noskip` values,
+// or an empty string if it should not.
+func skipReason(skip, noSkip string) string {
+	// Skip if asked
+	if strings.ToLower(skip) == "true" {
+		return "skip: " + skip
+	}
+	// Don't skip if asked
+	if len(noSkip) > 0 && strings.ToLower(noSkip) != "true" {
+		return "noskip: " + noSkip
+	}
+	return ""
+}
+
+// SkipReason returns why the group should be skipped based on its `skip` and `noskip` values,
+// or an empty string if it should not.
+func (g *EntryGroup) SkipReason() string {
+	return skipReason(g.Skip, g.NoSkip)
+}
+
+// SkipReason returns why the entry should be skipped based on its `skip` and `noskip` values,
+// or an empty string if it should not.
+func (e *Entry) SkipReason() string {
+	return skipReason(e.Skip, e.NoSkip)
+}
+
+// groupSkipReason returns why the group "g" should be skipped, by its own fields or by the `Filter` option.
+func (r *Runner) groupSkipReason(g EntryGroup) string {
+	if reason := g.SkipReason(); reason != "" {
+		return reason
+	}
+	if r.opts.Filter != nil && !r.opts.Filter.MatchString(g.Name) {
+		return fmt.Sprintf("name does not match '%s'", r.opts.Filter)
+	}
+	return ""
+}
+
+// onFailure returns the `EntryGroup.OnFailure` of the group "g", or its default by the `FailFast` option.
+func (r *Runner) onFailure(g EntryGroup) string {
+	switch {
+	case g.OnFailure != "":
+		return g.OnFailure
+	case r.opts.FailFast:
+		return OnFailureAbort
+	default:
+		return OnFailureContinue
+	}
+}
+
+// abort skips the rest of the run because of the "reason", unless it is already aborted.
+func (r *Runner) abort(reason string) {
+	r.abortMu.Lock()
+	if r.abortReason == "" {
+		r.abortReason = reason
+	}
+	r.abortMu.Unlock()
+}
+
+// aborted returns why the rest of the run is skipped, or an empty string if it is not aborted.
+func (r *Runner) aborted() string {
+	r.abortMu.Lock()
+	defer r.abortMu.Unlock()
+	return r.abortReason
+}
+
+// dependencyFailed returns the skip reason of the entries that depend on the failed entry "v" of the group "group".
+func dependencyFailed(group string, v Entry) string {
+	name := v.Name
+	if name == "" {
+		name = strings.TrimSpace(v.Command)
+	}
+	return fmt.Sprintf("dependency failed: '%s' of group '%s'", name, group)
+}
+
+// skippedResult returns the result of the entry "v" that did not run because of the "reason".
+func skippedResult(v Entry, reason string) Result {
+	return Result{Name: v.Name, Command: v.Command, Status: "skipped", Exit: "skipped", SkipReason: reason, Test: v}
+}
+
+// prepare sets the default timeout of the entry "e" and maps the local and global vars to it.
+// Its kafka step gets the client of the runner.
+func (r *Runner) prepare(e *Entry, localVars map[string]string) {
+	// If timeout is missing, set the default. If it is <0, set infinite.
+	if e.Timeout == 0 {
+		e.Timeout = r.opts.DefaultTimeout
+	}
+	if e.Timeout < 0 {
+		e.Timeout = time.Duration(365 * 24 * time.Hour)
+	}
+	if e.MaxOutput == 0 {
+		e.MaxOutput = r.opts.MaxOutput
+	}
+	if len(e.vars) > 0 {
+		// The values of a foreach have priority over the local vars, their names are verified by `New`.
+		vars, _ := checkVarNames(e.vars)
+		for k, v := range localVars {
+			if _, ok := vars[k]; !ok {
+				vars[k] = v
+			}
+		}
+		localVars = vars
+	}
+
+	e.mapVars(localVars, r.getGlobalVars(), r.uniques)
+	if e.Kafka != nil {
+		e.Kafka.newClient = r.newKafkaClient
+	}
+}
+
+// runGroup executes the setup, the entries and the teardown of the group "v" in order.
+// It returns false for the reserved coyote group which does not run at all.
+// The entries of a skipped group, and the skipped entries, are marked as skipped.
+// The group is skipped with the "depsReason" if it is set, as one of its dependencies failed.
+// The entries that did not start before "ctx" was done are marked as not run,
+// the teardown runs even then, unless the group had not started.
+func (r *Runner) runGroup(ctx context.Context, v EntryGroup, depsReason string, hook EntryHook) (ResultGroup, bool) {
+	var resultGroup = ResultGroup{
+		Name: v.Name,
+		Type: v.Type,
+	}
+
+	// Reserved name coyote is used to set the title (and maybe other global vars in the future).
+	if v.Name == "coyote" {
+		return resultGroup, false
+	}
+
+	// Skip test if asked
+	groupSkipReason := r.groupSkipReason(v)
+	if groupSkipReason != "" {
+		r.opts.Logger.Printf("Skipping processing group: [ %s ], %s\n", v.Name, groupSkipReason)
+		resultGroup.SkipReason = groupSkipReason
+		groupSkipReason = "group " + groupSkipReason
+	} else if groupSkipReason = r.aborted(); groupSkipReason != "" {
+		r.opts.Logger.Printf("Skipping processing group: [ %s ], %s\n", v.Name, groupSkipReason)
+		resultGroup.SkipReason = groupSkipReason
+	} else if groupSkipReason = depsReason; groupSkipReason != "" {
+		r.opts.Logger.Printf("Skipping processing group: [ %s ], %s\n", v.Name, groupSkipReason)
+		resultGroup.SkipReason = groupSkipReason
+	} else if ctx.Err() == nil {
+		r.opts.Logger.Printf("Starting processing group: [ %s ]\n", v.Name)
+	}
+	groupRun := r.StartGroup(v)
+	groupRun.hook = hook
+	// The teardown runs even if the run is interrupted later on.
+	teardownCtx, cancelTeardown := r.teardownContext(ctx)
+	defer cancelTeardown()
+
+	onFailure := r.onFailure(v)
+	var setupRunning, running []int
+	resultGroup.Setup, setupRunning = r.runEntries(ctx, groupRun, v.Setup, "setup: ", groupSkipReason, onFailure)
+	entriesSkipReason := groupSkipReason
+	if entriesSkipReason == "" && failed(resultGroup.Setup) {
+		r.opts.Logger.Printf("Setup failed, skipping the entries of group: [ %s ]\n", v.Name)
+		entriesSkipReason = "setup failed"
+	}
+	resultGroup.Results, running = r.runEntries(ctx, groupRun, v.Entries, "", entriesSkipReason, onFailure)
+
+	// Stop the background entries and complete their results.
+	closed := groupRun.Close()
+	completeResults(resultGroup.Setup, setupRunning, closed[:len(setupRunning)])
+	completeResults(resultGroup.Results, running, closed[len(setupRunning):])
+
+	resultGroup.Teardown, running = r.runEntries(teardownCtx, groupRun, v.Teardown, "teardown: ", groupSkipReason, "")
+	completeResults(resultGroup.Teardown, running, groupRun.Close())
+
+	for _, t := range resultGroup.Results {
+		resultGroup.TotalTime += t.Time
+		switch t.Status {
+		case "ok":
+			resultGroup.Passed++
+		case "skipped":
+			resultGroup.Skipped++
+		case "not run":
+		default:
+			resultGroup.Errors++
+		}
+	}
+	resultGroup.Total = resultGroup.Passed + resultGroup.Errors
+
+	for _, t := range append(resultGroup.Setup, resultGroup.Teardown...) {
+		resultGroup.TotalTime += t.Time
+		if resultFailed(t) {
+			resultGroup.FixtureErrors++
+		}
+	}
+
+	return resultGroup, true
+}
+
+// teardownContext returns the context of the teardown of a group that starts now. It is not done with "ctx",
+// so the teardown cleans up after an interrupted run too, but `Options.TeardownGrace` after it,
+// and never after the deadline of "ctx". The teardown does not run if "ctx" is already done.
+func (r *Runner) teardownContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() != nil {
+		return ctx, func() {}
+	}
+
+	var teardownCtx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		teardownCtx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	} else {
+		teardownCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
+	stop := context.AfterFunc(ctx, func() {
+		select {
+		case <-time.After(r.opts.TeardownGrace):
+			cancel()
+		case <-teardownCtx.Done():
+		}
+	})
+	return teardownCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// runEntries runs the "entries" of the group run "g" in order, named with the "prefix" for its hook,
+// and returns the results of the ones without nolog.
+// It also returns the indexes of the results of the background entries that are still running,
+// in the order they started, -1 for the ones with nolog. The entries are skipped if the "skipReason" is set.
+//
+// Once an entry fails the next ones are skipped or the run is aborted based on the "onFailure" of the group,
+// see `EntryGroup.OnFailure`. An empty "onFailure" runs all the entries, even if the run is aborted, as the teardown does.
+func (r *Runner) runEntries(ctx context.Context, g *GroupRun, entries []Entry, prefix, skipReason, onFailure string) (results []Result, running []int) {
+	for i, v := range entries {
+		t := g.hookEntry(prefix+entryName(i, v), func() Result {
+			if skipReason == "" && onFailure != "" {
+				skipReason = r.aborted()
+			}
+
+			if skipReason != "" {
+				return skippedResult(v, skipReason)
+			} else if reason := v.SkipReason(); reason != "" { // Skip command if asked
+				return skippedResult(v, reason)
+			} else if ctx.Err() != nil {
+				return Result{Name: v.Name, Command: v.Command, Status: "not run", Exit: "not run", Test: v}
+			}
+
+			t := g.RunEntry(ctx, v)
+			if onFailure != "" && resultFailed(t) && ctx.Err() == nil {
+				reason := dependencyFailed(g.Group.Name, v)
+				switch {
+				case v.Critical || onFailure == OnFailureAbort:
+					r.opts.Logger.Printf("Aborting the run, test '%s' failed\n", v.Name)
+					r.abort(reason)
+					skipReason = reason
+				case onFailure == OnFailureSkipRest:
+					r.opts.Logger.Printf("Skipping the rest of group [ %s ], test '%s' failed\n", g.Group.Name, v.Name)
+					skipReason = reason
+				}
+			}
+			return t
+		})
+		if t.Status == "running" {
+			running = append(running, -1)
+		}
+		if v.NoLog == false {
+			if t.Status == "running" {
+				running[len(running)-1] = len(results)
+			}
+			results = append(results, t)
+		}
+	}
+	return results, running
+}
+
+// entryName returns the name of the entry "v", the "i"th of its group, or its command if it has no name.
+func entryName(i int, v Entry) string {
+	switch {
+	case v.Name != "":
+		return v.Name
+	case v.Command != "":
+		return strings.TrimSpace(v.Command)
+	default:
+		return fmt.Sprintf("entry_%d", i)
+	}
+}
+
+// completeResults replaces the results of the background entries that were "running"
+// with their complete results, the "closed" ones, see `GroupRun.Close`.
+func completeResults(results []Result, running []int, closed []Result) {
+	for i, t := range closed {
+		if running[i] >= 0 {
+			results[running[i]] = t
+		}
+	}
+}
+
+// resultFailed reports whether the result "t" failed, the skipped and the not run ones did not.
+func resultFailed(t Result) bool {
+	switch t.Status {
+	case "ok", "running", "skipped", "not run":
+		return false
+	default:
+		return true
+	}
+}
+
+// completed reports whether the group of the results "g" ran its setup and its entries to the end.
+// The entries skipped by their own `skip` and `noskip` do not count, the ones skipped or not run
+// because the group was skipped, the run was aborted or interrupted do.
+func completed(g ResultGroup) bool {
+	if g.SkipReason != "" {
+		return false
+	}
+	for _, t := range append(append([]Result{}, g.Setup...), g.Results...) {
+		if t.Status == "not run" || (t.Status == "skipped" && t.SkipReason != t.Test.SkipReason()) {
+			return false
+		}
+	}
+	return true
+}
+
+// failed reports whether any of the "results" failed.
+func failed(results []Result) bool {
+	for _, t := range results {
+		if resultFailed(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupRun runs the entries of a group one at a time, see `Runner.StartGroup`.
+type GroupRun struct {
+	r         *Runner
+	localVars map[string]string
+	// background are the entries started in the background, in the order they started.
+	background []*backgroundEntry
+	// hook wraps the runs of the entries, if set, see `GroupHook`.
+	hook EntryHook
+
+	// Group is the group that runs, with the variables of its title replaced.
+	Group EntryGroup
+}
+
+// StartGroup starts the run of the group "g", one of the groups the runner was created with.
+// The run holds the variables of the group, including the ones registered by its entries,
+// so the entries of "g" should run through it, in order.
+func (r *Runner) StartGroup(g EntryGroup) *GroupRun {
+	// Check for Local Variables, their names are verified by `New`.
+	localVars, _ := checkVarNames(g.Vars)
+	// Replace any variables in title
+	g.Title = replaceVars(g.Title, localVars, r.getGlobalVars())
+
+	return &GroupRun{r: r, localVars: localVars, Group: g}
+}
+
+// hookEntry runs the entry named "name" with "run", through the hook of the group run if it has one.
+func (g *GroupRun) hookEntry(name string, run func() Result) Result {
+	if g.hook == nil {
+		return run()
+	}
+
+	var t Result
+	ran := false
+	g.hook(name, func() Result {
+		t, ran = run(), true
+		return t
+	})
+	if !ran {
+		t = run()
+	}
+	return t
+}
+
+// RunEntry runs the entry "e" of the group, including its sleeps, and returns its result.
+// The timeout of the entry is shortened to the deadline of "ctx", if any.
+// If "ctx" is done while the command runs, it is terminated like on timeout and its status is "interrupted".
+//
+// A background entry returns once it is ready with the status "running", `Close` returns its complete result.
+// The run must be closed once its entries ran, to stop the background entries.
+func (g *GroupRun) RunEntry(ctx context.Context, e Entry) Result {
+	var t Result
+	switch {
+	case e.Stop != "":
+		t = g.runStop(e)
+	case e.Background:
+		t = g.runBackground(ctx, e)
+	default:
+		t = g.r.runEntry(ctx, e, g.localVars)
+	}
+
+	if e.SleepAfter > 0 {
+		if !e.NoLog {
+			g.r.opts.Logger.Printf("Wait for %d seconds after the test '%s' ran\n", int(e.SleepAfter.Seconds()), e.Name)
+		}
+		sleep(ctx, e.SleepAfter)
+	}
+
+	return t
+}
+
+// runEntry executes the command of the entry "v" and classifies its outcome.
+// Values captured by the entry's `register` are stored inside "localVars".
+//
+// If the entry has retries, the command runs again while it fails (or, in `until` mode,
+// while its output tests fail) and every attempt is kept in the result.
+func (r *Runner) runEntry(ctx context.Context, v Entry, localVars map[string]string) Result {
+	r.prepare(&v, localVars)
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < v.Timeout {
+			v.Timeout = remaining
+		}
+	}
+	// A step is described by its command but it is not a command, it is never parsed.
+	var args []string
+	s := v.step()
+	if s != nil {
+		v.Command = s.String()
+	} else {
+		var err error
+		if args, err = shellwords.Parse(v.Command); err != nil {
+			r.opts.Logger.Printf("Error when parsing command [ %s ] for [ %s ]\n", v.Command, v.Name)
+		}
+	}
+
+	if v.SleepBefore > 0 {
+		if !v.NoLog {
+			r.opts.Logger.Printf("Wait for %d seconds before run the test '%s'\n", int(v.SleepBefore.Seconds()), v.Name)
+		}
+		if !sleep(ctx, v.SleepBefore) {
+			return Result{Name: v.Name, Command: v.Command, Status: "not run", Exit: "not run", Test: v}
+		}
+	}
+
+	if s == nil && len(args) == 0 { // Empty command?
+		r.opts.Logger.Printf("Entry %s is missing the command field.\n", v.Name)
+		return Result{Name: v.Name, Status: "error", Exit: "missing command", Stderr: []string{"the command field is missing"}, Test: v}
+	}
+
+	interval := v.RetryInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var (
+		t        Result
+		attempts []Attempt
+		total    float64
+		start    = time.Now()
+	)
+	for attempt := 0; ; attempt++ {
+		var (
+			stdout, stderr         = new(spool), new(spool)
+			timerLive, interrupted bool
+			elapsed                time.Duration
+			err                    error
+		)
+		if s != nil {
+			timerLive, interrupted, elapsed, err = r.execStep(ctx, v, s, stdout, stderr)
+		} else {
+			timerLive, interrupted, elapsed, err = r.execEntry(ctx, v, args, stdout, stderr)
+		}
+		total += elapsed.Seconds()
+
+		// Perform a textTest on outputs.
+		_, textErr := v.test(stdout, stderr)
+
+		retry := !interrupted && attempt < v.Retries && (textErr != nil || !timerLive || (!v.Until && !v.exitPassed(err)))
+		if !retry {
+			// Capture the requested values for the next entries.
+			if regErr := v.Register.apply(stdout, stderr, localVars, r.setGlobalVar); regErr != nil {
+				if textErr != nil {
+					regErr = errors.New(textErr.Error() + regErr.Error())
+				}
+				textErr = regErr
+			}
+		}
+
+		t = r.classifyEntry(v, stdout.text(int64(v.MaxOutput)), stderr.text(int64(v.MaxOutput)), err, textErr, timerLive)
+		if interrupted {
+			r.opts.Logger.Printf("Interrupted, command '%s', test '%s'\n", v.Command, v.Name)
+			t.Status = "interrupted"
+			t.Exit = "(interrupted) " + strings.TrimPrefix(t.Exit, "(timeout) ")
+		}
+		t.Time = elapsed.Seconds()
+		if v.WaitFor != nil && t.Status == "ok" {
+			// The earlier attempts and the intervals between them are part of the wait.
+			t.ReadyTime = time.Since(start).Seconds()
+		}
+		if v.Retries > 0 {
+			attempts = append(attempts, Attempt{Status: t.Status, Time: t.Time, Stdout: t.Stdout, Stderr: t.Stderr, Exit: t.Exit})
+		}
+
+		if !retry {
+			if r.opts.ArtifactsDir != "" && !v.NoLog {
+				t.StdoutFile, t.StderrFile = r.saveArtifacts(v, stdout, stderr)
+			}
+		}
+		stdout.Close()
+		stderr.Close()
+
+		if !retry {
+			break
+		}
+
+		r.opts.Logger.Printf("Retrying test '%s' in %s, attempt %d of %d\n", v.Name, interval, attempt+2, v.Retries+1)
+		if !sleep(ctx, interval) {
+			break
+		}
+		if v.RetryBackoff > 1 {
+			interval = time.Duration(float64(interval) * v.RetryBackoff)
+		}
+	}
+
+	t.Time = total
+	t.Attempts = attempts
+	t.Test = v
+	return t
+}
+
+// execEntry runs the command "args" of the entry "v" and captures its outputs to "stdout" and "stderr".
+// The returned "timerLive" is false if the command was killed because of its timeout
+// and "interrupted" is true if it was terminated because "ctx" was done.
+func (r *Runner) execEntry(ctx context.Context, v Entry, args []string, stdout, stderr io.Writer) (timerLive, interrupted bool, elapsed time.Duration, err error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	setupCommand(cmd, v)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	killSignal, killGrace, err := v.killPolicy()
+	if err != nil {
+		return true, false, 0, err
+	}
+
+	// Run in a process group, so that on timeout the children
+	// of the command (i.e of a shell script) are terminated too.
+	setProcessGroup(cmd)
+
+	done := make(chan struct{})
+	cancelled := make(chan struct{})
+	// Terminate the command the same way as on timeout when "ctx" is done,
+	// it is a timeout too if the deadline of "ctx" was exceeded.
+	cmd.Cancel = func() error {
+		close(cancelled)
+		reason := "Interrupted"
+		if ctx.Err() == context.DeadlineExceeded {
+			reason = "Timeout"
+		}
+		go r.terminate(cmd, v, reason, killSignal, killGrace, done)
+		return nil
+	}
+
+	start := time.Now()
+	if err = cmd.Start(); err != nil {
+		return true, false, time.Since(start), err
+	}
+
+	timer := time.AfterFunc(v.Timeout, func() {
+		r.terminate(cmd, v, "Timeout", killSignal, killGrace, done)
+	})
+	err = cmd.Wait()
+	close(done)
+	timerLive = timer.Stop() // If command already exited, the timer is still live.
+	elapsed = time.Since(start)
+
+	select {
+	case <-cancelled:
+		if ctx.Err() == context.DeadlineExceeded {
+			timerLive = false
+		} else {
+			interrupted = true
+		}
+	default:
+	}
+
+	return timerLive, interrupted, elapsed, err
+}
+
+// saveArtifacts saves the whole outputs of the entry "v" under the `ArtifactsDir`
+// and returns the names of the files, empty for an empty output or on failure.
+func (r *Runner) saveArtifacts(v Entry, stdout, stderr *spool) (stdoutFile, stderrFile string) {
+	if err := os.MkdirAll(r.opts.ArtifactsDir, 0755); err != nil {
+		r.opts.Logger.Printf("Error when saving the outputs of test '%s': %v\n", v.Name, err)
+		return "", ""
+	}
+
+	name := fmt.Sprintf("%04d-%s", atomic.AddInt64(&r.artifacts, 1), artifactName(v.Name))
+	save := func(s *spool, suffix string) string {
+		if s.Size() == 0 {
+			return ""
+		}
+		file := filepath.Join(r.opts.ArtifactsDir, name+suffix)
+		if err := s.save(file); err != nil {
+			r.opts.Logger.Printf("Error when saving the outputs of test '%s': %v\n", v.Name, err)
+			return ""
+		}
+		return file
+	}
+	return save(stdout, ".stdout.log"), save(stderr, ".stderr.log")
+}
+
+var artifactNameReplacer = regexp.MustCompile("[^A-Za-z0-9_-]+")
+
+// artifactName returns the test "name" in a form safe for a file name.
+func artifactName(name string) string {
+	name = strings.Trim(artifactNameReplacer.ReplaceAllString(name, "_"), "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if name == "" {
+		name = "entry"
+	}
+	return name
+}
+
+// setupCommand sets the workdir, the stdin and the env vars of the entry "v" to its command "cmd".
+func setupCommand(cmd *exec.Cmd, v Entry) {
+	if len(v.WorkDir) > 0 {
+		cmd.Dir = v.WorkDir
+	}
+	if len(v.Stdin) > 0 {
+		cmd.Stdin = strings.NewReader(v.Stdin)
+	}
+	cmd.Env = os.Environ()
+	if len(v.EnvVars) > 0 {
+		for _, v := range v.EnvVars {
+			cmd.Env = append(cmd.Env, v)
+		}
+	}
+}
+
+// sleep waits for "d" unless "ctx" is done first, it returns false if "ctx" is done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// terminate sends "sig" to the command "cmd" of the entry "v" and its children,
+// because of a timeout or an interruption, the "reason".
+// Unless "sig" is SIGKILL, whatever is still running after "grace",
+// or after the command has exited, is killed.
+func (r *Runner) terminate(cmd *exec.Cmd, v Entry, reason string, sig syscall.Signal, grace time.Duration, done <-chan struct{}) {
+	r.opts.Logger.Printf("%s, sending %s to command '%s', test '%s'\n", reason, signalName(sig), v.Command, v.Name)
+	signalProcessGroup(cmd, sig)
+	if sig == syscall.SIGKILL {
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		r.opts.Logger.Printf("Command '%s', test '%s' still running %s after %s, killing it\n", v.Command, v.Name, grace, signalName(sig))
+	}
+	signalProcessGroup(cmd, syscall.SIGKILL)
+}
+
+// classifyEntry logs the outcome "runErr" of a command and converts it to a `Result`.
+func (r *Runner) classifyEntry(v Entry, stdout, stderr string, runErr, textErr error, timerLive bool) Result {
+	err, expectedExit := runErr, false
+	if v.hasExitExpectations() && !v.IgnoreExitCode {
+		err = v.checkExit(runErr)
+		expectedExit = err == nil
+	}
+	if runErr == nil && !timerLive {
+		// The command exited by itself on the kill signal, still it did not finish in time.
+		err, expectedExit = errors.New("exit status 0"), false
+	}
+
+	if err != nil && timerLive && !v.IgnoreExitCode && textErr != nil {
+		r.opts.Logger.Printf("Error, command '%s', test '%s'. Error: %s, Stderr: %s\n", v.Command, v.Name, err.Error(), strconv.Quote(stderr))
+	} else if err != nil && !timerLive {
+		r.opts.Logger.Printf("Timeout, command '%s', test '%s'. Error: %s, Stderr: %s\n", v.Command, v.Name, err.Error(), strconv.Quote(stderr))
+	} else if textErr != nil {
+		r.opts.Logger.Printf("Output Error, command '%s', test '%s'. Error: %s, Stderr: %s\n", v.Command, v.Name, textErr.Error(), strconv.Quote(stdout))
+	} else {
+		r.opts.Logger.Printf("Success, command '%s', test '%s'. Stdout: %s\n", v.Command, v.Name, strconv.Quote(stdout))
+	}
+
+	var t = Result{Name: v.Name, Command: v.Command, Stdout: strings.Split(stdout, "\n"), Stderr: strings.Split(stderr, "\n")}
+
+	if (err == nil || v.IgnoreExitCode) && textErr == nil {
+		t.Status = "ok"
+		if err != nil { // Here we have ignore_exit_code
+			t.Exit = "(ignore) " + strings.Replace(err.Error(), "exit status ", "", 1)
+		} else if expectedExit && runErr != nil { // Here we exited as expected by exit_code or signal
+			t.Exit = strings.Replace(runErr.Error(), "exit status ", "", 1)
+		} else { // Here we exited normally
+			t.Exit = "0"
+		}
+	} else {
+		t.Status = "error"
+		if err != nil && !v.IgnoreExitCode {
+			t.Exit = strings.Replace(err.Error(), "exit status ", "", 1)
+		} else {
+			t.Exit = "text"
+			t.Stderr = append(t.Stderr, strings.Split(textErr.Error(), "\n")...)
+		}
+		if !timerLive {
+			t.Status = "timeout"
+			t.Exit = "(timeout) " + t.Exit
+		}
+	}
+	if _, sig, signaled := exitStatus(runErr); signaled {
+		t.Signal = signalName(sig)
+	}
+	// Clean Recursively Empty Top Lines from Output
+	t.Stdout = recurseClean(t.Stdout)
+	t.Stderr = recurseClean(t.Stderr)
+
+	return t
+}
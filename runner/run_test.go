@@ -0,0 +1,787 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunGroupsParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the sleep command")
+	}
+
+	yamlContents := []byte(`
+- name: coyote
+  title: Parallel
+
+- name: First
+  parallel: true
+  entries:
+    - command: sleep 0.5
+    - command: echo "%UNIQUE_ID%"
+
+- name: Second
+  parallel: true
+  entries:
+    - command: sleep 0.5
+
+- name: Skipped
+  skip: true
+  entries:
+    - command: sleep 0.5
+
+- name: Third
+  parallel: true
+  entries:
+    - command: sleep 0.5`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	results := newTestRunner(t, groups, Options{Parallel: 3}).runGroups(context.Background(), groups)
+	if elapsed := time.Since(start); elapsed > 1400*time.Millisecond {
+		t.Fatalf("expected parallel groups to run concurrently but took %s", elapsed)
+	}
+
+	expected := []string{"First", "Second", "Skipped", "Third"}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d result groups but got %d", len(expected), len(results))
+	}
+	for i, name := range expected {
+		if got := results[i].Name; got != name {
+			t.Fatalf("[%d] expected result group '%s' but got '%s'", i, name, got)
+		}
+		if results[i].Errors != 0 {
+			t.Fatalf("[%d] expected group '%s' to pass: %v", i, name, results[i].Results)
+		}
+	}
+	if results[2].Skipped != 1 || results[2].Total != 0 {
+		t.Fatalf("expected the entry of the skipped group to be counted as skipped but got %d skipped of %d", results[2].Skipped, results[2].Total)
+	}
+}
+
+func TestRunGroupsSequential(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the sleep command")
+	}
+
+	yamlContents := []byte(`
+- name: First
+  parallel: true
+  entries:
+    - command: sleep 0.3
+
+- name: Barrier
+  entries:
+    - command: sleep 0.3
+
+- name: Last
+  parallel: true
+  entries:
+    - command: sleep 0.3`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	results := newTestRunner(t, groups, Options{Parallel: 4}).runGroups(context.Background(), groups)
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("expected non-parallel group to run alone but all finished in %s", elapsed)
+	}
+
+	if len(results) != 3 || results[1].Name != "Barrier" {
+		t.Fatalf("unexpected results order: %v", results)
+	}
+}
+
+func TestRunEntryRetries(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires bash")
+	}
+
+	counter := filepath.Join(t.TempDir(), "count")
+	tests := []struct {
+		entry    Entry
+		status   string
+		attempts int
+	}{
+		{
+			entry: Entry{
+				Name:          "passes on third attempt",
+				Command:       fmt.Sprintf(`bash -c 'echo x >> %s-1; test $(wc -l < %s-1) -ge 3'`, counter, counter),
+				Retries:       5,
+				RetryInterval: 10 * time.Millisecond,
+				RetryBackoff:  2,
+			},
+			status:   "ok",
+			attempts: 3,
+		},
+		{
+			entry: Entry{
+				Name:          "polls until output matches",
+				Command:       fmt.Sprintf(`bash -c 'echo x >> %s-2; wc -l < %s-2; exit 1'`, counter, counter),
+				Retries:       5,
+				RetryInterval: 10 * time.Millisecond,
+				Until:         true,
+				Stdout:        OutFilters{{Match: []string{"2"}}},
+			},
+			status:   "error", // output matched but the last attempt still exited with 1.
+			attempts: 2,
+		},
+		{
+			entry: Entry{
+				Name:          "runs out of attempts",
+				Command:       "false",
+				Retries:       2,
+				RetryInterval: 10 * time.Millisecond,
+			},
+			status:   "error",
+			attempts: 3,
+		},
+	}
+
+	for i, tt := range tests {
+		result := newTestRunner(t, nil, Options{}).runEntry(context.Background(), tt.entry, map[string]string{})
+		if result.Status != tt.status {
+			t.Fatalf("[%d] test '%s' expected status '%s' but got '%s'", i, tt.entry.Name, tt.status, result.Status)
+		}
+		if len(result.Attempts) != tt.attempts {
+			t.Fatalf("[%d] test '%s' expected %d attempts but got %d", i, tt.entry.Name, tt.attempts, len(result.Attempts))
+		}
+		if last := result.Attempts[len(result.Attempts)-1]; last.Exit != result.Exit {
+			t.Fatalf("[%d] test '%s' expected the last attempt to be the result", i, tt.entry.Name)
+		}
+	}
+}
+
+func TestRunEntryTimeoutKillsProcessGroup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires bash and process groups")
+	}
+
+	tests := []struct {
+		entry  Entry
+		signal string
+	}{
+		// The background sleep keeps the output open, it must be terminated too for the command to return.
+		{Entry{Command: "bash -c 'sleep 30 & wait'", Timeout: 200 * time.Millisecond, KillSignal: "SIGTERM"}, "SIGTERM"},
+		{Entry{Command: "bash -c 'sleep 30 & wait'", Timeout: 200 * time.Millisecond}, "SIGKILL"},
+		// SIGTERM is ignored by the shell and the sleep, so they are killed after the grace period.
+		{Entry{Command: "bash -c 'trap \"\" TERM; sleep 30 & wait'", Timeout: 200 * time.Millisecond, KillGrace: 300 * time.Millisecond}, "SIGKILL"},
+		// The shell exits by itself on SIGTERM, still it is a timeout.
+		{Entry{Command: "bash -c 'trap \"exit 0\" TERM; sleep 30 & wait'", Timeout: 200 * time.Millisecond, KillSignal: "TERM"}, ""},
+	}
+
+	for i, tt := range tests {
+		start := time.Now()
+		result := newTestRunner(t, nil, Options{}).runEntry(context.Background(), tt.entry, map[string]string{})
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("[%d] expected the command to be terminated but it took %s", i, elapsed)
+		}
+		if result.Status != "timeout" || result.Signal != tt.signal {
+			t.Fatalf("[%d] expected status 'timeout' and signal '%s' but got '%s' and '%s' (exit '%s')", i, tt.signal, result.Status, result.Signal, result.Exit)
+		}
+	}
+}
+
+// newTestRunner returns the runner of "groups", failing the test if their vars are not valid.
+func newTestRunner(t *testing.T, groups []EntryGroup, opts Options) *Runner {
+	t.Helper()
+
+	r, err := New(groups, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRunEntryContextDeadline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the sleep command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result := newTestRunner(t, nil, Options{}).runEntry(ctx, Entry{Command: "sleep 30"}, map[string]string{})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the timeout to be shortened to the deadline but took %s", elapsed)
+	}
+	if result.Status != "timeout" {
+		t.Fatalf("expected status 'timeout' but got '%s'", result.Status)
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires bash and process groups")
+	}
+
+	yamlContents := []byte(`
+- name: First
+  entries:
+    - command: echo "before"
+    - command: bash -c 'sleep 30 & wait'
+      kill_signal: SIGTERM
+    - command: echo "after"
+
+- name: Second
+  entries:
+    - command: echo "never"`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+
+	start := time.Now()
+	data, err := Run(ctx, groups, Options{})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the running command to be terminated but took %s", elapsed)
+	}
+	if err != context.Canceled || !data.Interrupted {
+		t.Fatalf("expected the run to be interrupted but got error %v", err)
+	}
+
+	expected := [][]string{{"ok", "interrupted", "not run"}, {"not run"}}
+	if len(data.Results) != len(expected) {
+		t.Fatalf("expected %d result groups but got %d", len(expected), len(data.Results))
+	}
+	for i, statuses := range expected {
+		for j, status := range statuses {
+			if got := data.Results[i].Results[j].Status; got != status {
+				t.Fatalf("[%d][%d] expected status '%s' but got '%s'", i, j, status, got)
+			}
+		}
+	}
+
+	if data.Successful != 1 || data.Errors != 1 || data.TotalTests != 2 {
+		t.Fatalf("expected the not run entries to be left out of the totals but got %d passed and %d errors", data.Successful, data.Errors)
+	}
+}
+
+func TestRunSkipped(t *testing.T) {
+	yamlContents := []byte(`
+- name: First
+  entries:
+    - command: echo "first"
+    - command: echo "skip"
+      skip: true
+    - command: echo "noskip"
+      noskip: 'false'
+
+- name: Skipped
+  skip: true
+  entries:
+    - command: echo "never"
+
+- name: Filtered
+  entries:
+    - command: echo "never"`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Run(context.Background(), groups, Options{Filter: regexp.MustCompile("First|Skipped")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"", "skip: true", "noskip: false"},
+		{"group skip: true"},
+		{"group name does not match 'First|Skipped'"},
+	}
+	if len(data.Results) != len(expected) {
+		t.Fatalf("expected %d result groups but got %d", len(expected), len(data.Results))
+	}
+	for i, reasons := range expected {
+		for j, reason := range reasons {
+			result := data.Results[i].Results[j]
+			if result.SkipReason != reason {
+				t.Fatalf("[%d][%d] expected skip reason '%s' but got '%s'", i, j, reason, result.SkipReason)
+			}
+			if status := "skipped"; reason != "" && result.Status != status {
+				t.Fatalf("[%d][%d] expected status '%s' but got '%s'", i, j, status, result.Status)
+			}
+		}
+	}
+
+	if data.Successful != 1 || data.Skipped != 4 || data.TotalTests != 1 {
+		t.Fatalf("expected 1 passed and 4 skipped of 1 test but got %d passed and %d skipped of %d", data.Successful, data.Skipped, data.TotalTests)
+	}
+}
+
+func TestRunSetupTeardown(t *testing.T) {
+	yamlContents := []byte(`
+- name: Setup failed
+  setup:
+    - command: echo "setup"
+    - command: false
+  entries:
+    - command: echo "never"
+  teardown:
+    - command: echo "teardown"
+
+- name: Entries failed
+  setup:
+    - command: echo "setup"
+  entries:
+    - command: false
+    - command: echo "entry"
+  teardown:
+    - command: false
+    - command: echo "teardown"`)
+	if runtime.GOOS == "windows" {
+		yamlContents = bytes.Replace(yamlContents, []byte("echo"), []byte("cmd /C echo"), -1)
+		yamlContents = bytes.Replace(yamlContents, []byte("command: false"), []byte("command: cmd /C exit 1"), -1)
+	}
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := func(results []Result) string {
+		var s []string
+		for _, result := range results {
+			s = append(s, result.Status)
+		}
+		return strings.Join(s, ",")
+	}
+	expected := []struct{ setup, entries, teardown string }{
+		{"ok,error", "skipped", "ok"},
+		{"ok", "error,ok", "error,ok"},
+	}
+	for i, e := range expected {
+		g := data.Results[i]
+		if got := [3]string{statuses(g.Setup), statuses(g.Results), statuses(g.Teardown)}; got != [3]string{e.setup, e.entries, e.teardown} {
+			t.Fatalf("[%d] expected the statuses %v but got %v", i, e, got)
+		}
+	}
+	if reason := data.Results[0].Results[0].SkipReason; reason != "setup failed" {
+		t.Fatalf("expected the entries to be skipped as the setup failed but got '%s'", reason)
+	}
+
+	if data.Successful != 1 || data.Errors != 1 || data.Skipped != 1 || data.FixtureErrors != 2 {
+		t.Fatalf("expected 1 passed, 1 error, 1 skipped and 2 fixture errors but got %d, %d, %d and %d",
+			data.Successful, data.Errors, data.Skipped, data.FixtureErrors)
+	}
+}
+
+func TestRunTeardownInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires bash and process groups")
+	}
+
+	yamlContents := []byte(`
+- name: Interrupted
+  entries:
+    - command: bash -c 'sleep 30 & wait'
+      kill_signal: SIGTERM
+  teardown:
+    - command: echo "teardown"
+
+- name: Not started
+  entries:
+    - command: echo "never"
+  teardown:
+    - command: echo "never"`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+
+	data, err := Run(ctx, groups, Options{})
+	if err != context.Canceled {
+		t.Fatalf("expected the run to be interrupted but got error %v", err)
+	}
+
+	if got := data.Results[0].Teardown; len(got) != 1 || got[0].Status != "ok" {
+		t.Fatalf("expected the teardown to run after the interruption but got %v", got)
+	}
+	if got := data.Results[1].Teardown; len(got) != 1 || got[0].Status != "not run" {
+		t.Fatalf("expected the teardown of a group that did not start to not run but got %v", got)
+	}
+}
+
+func TestRunTeardownBounded(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires bash and process groups")
+	}
+
+	yamlContents := []byte(`
+- name: Sleeping teardown
+  entries:
+    - command: %s
+  teardown:
+    - command: bash -c 'sleep 30 & wait'`)
+
+	tests := []struct {
+		name    string
+		command string
+		status  string
+		ctx     func() (context.Context, context.CancelFunc)
+	}{
+		{"deadline", "echo", "timeout", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 500*time.Millisecond)
+		}},
+		{"interrupted", "bash -c 'sleep 30 & wait'", "interrupted", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(300*time.Millisecond, cancel)
+			return ctx, cancel
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var groups []EntryGroup
+			if err := TextEntryGroupLoader([]byte(fmt.Sprintf(string(yamlContents), tt.command))).Load(&groups); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			data, _ := Run(ctx, groups, Options{TeardownGrace: 300 * time.Millisecond})
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Fatalf("expected the teardown to be stopped but the run took %s", elapsed)
+			}
+			if got := data.Results[0].Teardown; len(got) != 1 || got[0].Status != tt.status {
+				t.Fatalf("expected the teardown to be stopped with status '%s' but got %v", tt.status, got)
+			}
+		})
+	}
+}
+
+func TestRunGroupHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the echo command")
+	}
+
+	yamlContents := []byte(`
+- name: coyote
+  title: Hooks
+
+- name: Hooked
+  setup:
+    - command: echo setup
+  entries:
+    - name: greet
+      command: " echo hello"
+    - skip: "true"
+  teardown:
+    - command: echo bye
+
+- name: Skipped
+  skip: "true"
+  entries:
+    - command: echo never`)
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	hook := func(g EntryGroup, run func(EntryHook) ResultGroup) {
+		result := run(func(name string, run func() Result) {
+			got = append(got, g.Name+"/"+name+": "+run().Status)
+		})
+		got = append(got, g.Name+": "+result.SkipReason)
+	}
+	if _, err := Run(context.Background(), groups, Options{GroupHook: hook}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"Hooked/setup: echo setup: ok",
+		"Hooked/greet: ok",
+		"Hooked/entry_1: skipped",
+		"Hooked/teardown: echo bye: ok",
+		"Hooked: ",
+		"Skipped/echo never: skipped",
+		"Skipped: skip: true",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected the hooks to run:\n%s\n\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestRunOnFailure(t *testing.T) {
+	yamlContents := []byte(`
+- name: Continue
+  on_failure: continue
+  entries:
+    - command: "false"
+    - command: echo "continue"
+
+- name: Skip rest
+  on_failure: skip_rest
+  entries:
+    - name: Create topic
+      command: "false"
+    - command: echo "never"
+  teardown:
+    - command: echo "teardown"
+
+- name: Critical
+  entries:
+    - command: echo "first"
+    - name: Start broker
+      command: "false"
+      critical: true
+    - command: echo "never"
+
+- name: Aborted
+  entries:
+    - command: echo "never"`)
+	if runtime.GOOS == "windows" {
+		yamlContents = bytes.Replace(yamlContents, []byte("echo"), []byte("cmd /C echo"), -1)
+		yamlContents = bytes.Replace(yamlContents, []byte(`command: "false"`), []byte("command: cmd /C exit 1"), -1)
+	}
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts     Options
+		expected [][]string
+	}{
+		{
+			opts: Options{},
+			expected: [][]string{
+				{"", ""},
+				{"", "dependency failed: 'Create topic' of group 'Skip rest'"},
+				{"", "", "dependency failed: 'Start broker' of group 'Critical'"},
+				{"dependency failed: 'Start broker' of group 'Critical'"},
+			},
+		},
+		{
+			// The groups with a policy keep it.
+			opts: Options{FailFast: true},
+			expected: [][]string{
+				{"", ""},
+				{"", "dependency failed: 'Create topic' of group 'Skip rest'"},
+				{"", "", "dependency failed: 'Start broker' of group 'Critical'"},
+				{"dependency failed: 'Start broker' of group 'Critical'"},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		data, err := Run(context.Background(), groups, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j, reasons := range tt.expected {
+			for k, reason := range reasons {
+				result := data.Results[j].Results[k]
+				if result.SkipReason != reason {
+					t.Fatalf("[%d][%d][%d] expected skip reason '%s' but got '%s'", i, j, k, reason, result.SkipReason)
+				}
+			}
+		}
+		if got := data.Results[1].Teardown; len(got) != 1 || got[0].Status != "ok" {
+			t.Fatalf("[%d] expected the teardown to run after the failure but got %v", i, got)
+		}
+	}
+
+	groups[0].OnFailure = ""
+	data, err := Run(context.Background(), groups, Options{FailFast: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reason := "dependency failed: 'false' of group 'Continue'"
+	if runtime.GOOS == "windows" {
+		reason = "dependency failed: 'cmd /C exit 1' of group 'Continue'"
+	}
+	for j, skipped := range []int{1, 2, 3, 1} {
+		results := data.Results[j].Results
+		if got := results[len(results)-skipped].SkipReason; got != reason {
+			t.Fatalf("[%d] expected the fail fast to skip the rest with '%s' but got '%s'", j, reason, got)
+		}
+	}
+	if data.Errors != 1 || data.Skipped != 7 {
+		t.Fatalf("expected 1 error and 7 skipped but got %d and %d", data.Errors, data.Skipped)
+	}
+}
+
+func TestRunDependsOn(t *testing.T) {
+	yamlContents := []byte(`
+- name: Stream Reactor
+  parallel: true
+  depends_on: [ Setup ]
+  entries:
+    - command: echo "stream reactor"
+
+- name: Connect
+  parallel: true
+  depends_on: [ Brokers ]
+  entries:
+    - command: echo "never"
+
+- name: Sink
+  parallel: true
+  depends_on: [ Connect ]
+  entries:
+    - command: echo "never"
+
+- name: Brokers
+  parallel: true
+  entries:
+    - command: "false"
+
+- name: Setup
+  parallel: true
+  entries:
+    - command: echo "setup"`)
+	if runtime.GOOS == "windows" {
+		yamlContents = bytes.Replace(yamlContents, []byte("echo"), []byte("cmd /C echo"), -1)
+		yamlContents = bytes.Replace(yamlContents, []byte(`command: "false"`), []byte("command: cmd /C exit 1"), -1)
+	}
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, parallel := range []int{1, 4} {
+		data, err := Run(context.Background(), groups, Options{Parallel: parallel})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []struct{ name, status, reason string }{
+			{"Brokers", "error", ""},
+			{"Connect", "skipped", "dependency failed: group 'Brokers'"},
+			{"Sink", "skipped", "dependency failed: group 'Brokers'"},
+			{"Setup", "ok", ""},
+			{"Stream Reactor", "ok", ""},
+		}
+		if len(data.Results) != len(expected) {
+			t.Fatalf("[%d] expected %d result groups but got %d", parallel, len(expected), len(data.Results))
+		}
+		for i, e := range expected {
+			g := data.Results[i]
+			if g.Name != e.name || g.Results[0].Status != e.status || g.Results[0].SkipReason != e.reason {
+				t.Fatalf("[%d][%d] expected '%s' with status '%s' (%s) but got '%s' with status '%s' (%s)", parallel, i,
+					e.name, e.status, e.reason, g.Name, g.Results[0].Status, g.Results[0].SkipReason)
+			}
+		}
+	}
+
+	groups[0].DependsOn = []string{"Sink"}
+	groups[1].DependsOn = []string{"Stream Reactor"}
+	if _, err := Run(context.Background(), groups, Options{}); err == nil || !strings.Contains(err.Error(), "depend on each other") {
+		t.Fatalf("expected the run to fail on the cycle but got %v", err)
+	}
+}
+
+func TestRunDependsOnNotRun(t *testing.T) {
+	yamlContents := []byte(`
+- name: Setup
+  skip: true
+  entries:
+    - command: echo "setup"
+
+- name: Topics
+  entries:
+    - command: echo "topics"
+    - command: echo "optional"
+      skip: true
+
+- name: Connect
+  depends_on: [ Setup ]
+  entries:
+    - command: echo "never"
+
+- name: Sink
+  depends_on: [ Topics ]
+  entries:
+    - command: echo "sink"`)
+	if runtime.GOOS == "windows" {
+		yamlContents = bytes.Replace(yamlContents, []byte("echo"), []byte("cmd /C echo"), -1)
+	}
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts     Options
+		expected []struct{ name, status, reason string }
+	}{
+		{Options{}, []struct{ name, status, reason string }{
+			{"Setup", "skipped", "group skip: true"},
+			{"Topics", "ok", ""},
+			{"Connect", "skipped", "dependency not run: group 'Setup'"},
+			{"Sink", "ok", ""},
+		}},
+		{Options{Filter: regexp.MustCompile("Sink")}, []struct{ name, status, reason string }{
+			{"Setup", "skipped", "group skip: true"},
+			{"Topics", "skipped", "group name does not match 'Sink'"},
+			{"Connect", "skipped", "group name does not match 'Sink'"},
+			{"Sink", "skipped", "dependency not run: group 'Topics'"},
+		}},
+	}
+	for i, tt := range tests {
+		data, err := Run(context.Background(), groups, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data.Results) != len(tt.expected) {
+			t.Fatalf("[%d] expected %d result groups but got %d", i, len(tt.expected), len(data.Results))
+		}
+		for j, e := range tt.expected {
+			g := data.Results[j]
+			if g.Name != e.name || g.Results[0].Status != e.status || g.Results[0].SkipReason != e.reason {
+				t.Fatalf("[%d][%d] expected '%s' with status '%s' (%s) but got '%s' with status '%s' (%s)", i, j,
+					e.name, e.status, e.reason, g.Name, g.Results[0].Status, g.Results[0].SkipReason)
+			}
+		}
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runner loads and runs coyote test suites and writes their reports.
+//
+// A suite is loaded with `Load`, run with `Run` and its results are written
+// with `WriteHTML`, `WriteJSON` and `WriteJUnit`. The coyote command is a thin layer on top of it.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTitle is the title of the report if the suite does not set one.
+const DefaultTitle = "Coyote Tests"
+
+// Options configure a `Run`.
+type Options struct {
+	// Title is the title of the report, the title of the reserved coyote group overrides it.
+	// Defaults to `DefaultTitle`.
+	Title string
+	// DefaultTimeout is the timeout of the entries that do not set one.
+	// Defaults to 5 minutes, a negative value means no timeout.
+	DefaultTimeout time.Duration
+	// TeardownGrace is how long the teardowns of the groups may still run once the run is interrupted,
+	// defaults to 30 seconds. They never run after the deadline of the run, see `Run`.
+	TeardownGrace time.Duration
+	// Parallel is the maximum number of groups marked with `parallel` to run concurrently, defaults to 1.
+	Parallel int
+	// FailFast if true aborts the run on the first failure, it is the `EntryGroup.OnFailure`
+	// of the groups that do not set one, see `OnFailureAbort`.
+	FailFast bool
+	// Filter if set skips the groups with a name that does not match it, see the `-run` flag.
+	// The reserved coyote group is never skipped, it holds the title and the global vars.
+	Filter *regexp.Regexp
+	// MaxOutput is the default `Entry.MaxOutput`, zero keeps the whole outputs.
+	MaxOutput ByteSize
+	// ArtifactsDir if set is the directory to save the whole outputs of the entries under,
+	// the results link to them, see `Result.StdoutFile`.
+	ArtifactsDir string
+	// Logger receives the progress of the run, defaults to a logger that writes to the standard error.
+	Logger *log.Logger
+	// GroupHook if set wraps the run of each group, i.e to run the groups as go subtests, see the coyotetest package.
+	GroupHook GroupHook
+}
+
+// GroupHook wraps the run of the group "g". It must call "run" once, which runs the setup, the entries
+// and the teardown of the group, through the hook of its entries if it is not nil, and returns their results.
+// It is not called for the reserved coyote group.
+type GroupHook func(g EntryGroup, run func(EntryHook) ResultGroup)
+
+// EntryHook wraps the run of an entry of a group. It must call "run" once, which runs the entry and returns its result,
+// the skipped entries too. The "name" is the name of the entry or its command,
+// prefixed with "setup: " or "teardown: " for the entries of the setup and the teardown.
+type EntryHook func(name string, run func() Result)
+
+var (
+	uniqRegexp        = regexp.MustCompile("%UNIQUE_[0-9A-Za-z_-]+%")
+	acceptableVarName = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+)
+
+// Load loads the groups of the yaml "files" in the order of the files.
+// A file holds either a list of groups or a context with specs.
+// Their matrices are expanded and their dependencies sorted by `Run` and `Plan`.
+func Load(files ...string) ([]EntryGroup, error) {
+	var groups []EntryGroup
+	if err := FileContextLoader(files).Load(&groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Run runs the "groups" and returns their results.
+//
+// The reserved group with the name "coyote" sets the title of the results and the global vars.
+// If "ctx" is done the running commands are terminated and marked as interrupted,
+// the entries that did not start yet are marked as not run
+// and the partial results are returned along with the error of "ctx".
+//
+// The matrices of the groups are expanded and the groups run after their dependencies, see `ExpandMatrix` and `SortGroups`.
+func Run(ctx context.Context, groups []EntryGroup, opts Options) (ExportData, error) {
+	groups, err := SortGroups(ExpandMatrix(groups))
+	if err != nil {
+		return ExportData{}, err
+	}
+	r, err := New(groups, opts)
+	if err != nil {
+		return ExportData{}, err
+	}
+
+	resultsGroups := r.runGroups(ctx, groups)
+	data := newExportData(resultsGroups, r.Title())
+	data.Interrupted = ctx.Err() != nil
+	return data, ctx.Err()
+}
+
+// dateLayout is the layout of the `Date` of the results.
+const dateLayout = "2006 Jan 02, Mon, 15:04 MST"
+
+// newExportData sums up the results of the groups.
+func newExportData(resultsGroups []ResultGroup, title string) ExportData {
+	data := ExportData{
+		Results: resultsGroups,
+		Date:    time.Now().UTC().Format(dateLayout),
+		Title:   title,
+	}
+	for _, resultGroup := range resultsGroups {
+		data.Successful += resultGroup.Passed
+		data.Errors += resultGroup.Errors
+		data.Skipped += resultGroup.Skipped
+		data.FixtureErrors += resultGroup.FixtureErrors
+		data.TotalTime += resultGroup.TotalTime
+	}
+	data.TotalTests = data.Errors + data.Successful
+	return data
+}
+
+// MergeResults merges the results of earlier runs into one, in the order they were given.
+// The title and the date are the ones of the first results.
+// The merged results are interrupted if any of the results are.
+func MergeResults(results ...ExportData) ExportData {
+	var merged ExportData
+	for k, v := range results {
+		merged.Results = append(merged.Results, v.Results...)
+		merged.Errors += v.Errors
+		merged.Successful += v.Successful
+		merged.Skipped += v.Skipped
+		merged.FixtureErrors += v.FixtureErrors
+		merged.TotalTests += v.TotalTests
+		merged.TotalTime += v.TotalTime
+		merged.Interrupted = merged.Interrupted || v.Interrupted
+		if k == 0 {
+			merged.Title = v.Title
+			merged.Date = v.Date
+		}
+	}
+	return merged
+}
+
+// Runner runs the groups of a suite, or their entries one by one, see `Runner.StartGroup`.
+// It holds the state of a single run: its options, the global vars and the values of the named unique vars.
+//
+// `Run` is the simplest way to use it.
+type Runner struct {
+	opts Options
+
+	uniques *uniques
+
+	artifacts int64 // the number of the entries with saved outputs, accessed atomically.
+
+	globalVarsMu sync.RWMutex // protects globalVars.
+	globalVars   map[string]string
+
+	abortMu     sync.Mutex // protects abortReason.
+	abortReason string     // why the rest of the run is skipped, set once an entry aborts it.
+
+	newKafkaClient kafkaClientFunc // connects the kafka steps to their brokers.
+}
+
+// New returns the runner of the "groups". It applies the defaults to "opts" and reads the title
+// and the global vars from the coyote group of "groups". It also fails if the variable names of any group are not valid
+// or if their dependencies cannot be met, so a run never stops half way because of them.
+func New(groups []EntryGroup, opts Options) (*Runner, error) {
+	if _, err := dependencyOrder(groups); err != nil {
+		return nil, err
+	}
+
+	if opts.Title == "" {
+		opts.Title = DefaultTitle
+	}
+	if opts.DefaultTimeout == 0 {
+		opts.DefaultTimeout = 5 * time.Minute
+	}
+	if opts.TeardownGrace <= 0 {
+		opts.TeardownGrace = 30 * time.Second
+	}
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(os.Stderr, "", log.Ldate|log.Ltime)
+	}
+
+	r := &Runner{
+		opts:           opts,
+		uniques:        newUniques(),
+		globalVars:     make(map[string]string),
+		newKafkaClient: newFranzClient,
+	}
+
+	for _, g := range groups {
+		vars, err := checkVarNames(g.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("group '%s': %v", g.Name, err)
+		}
+		if err := checkOnFailure(g.OnFailure); err != nil {
+			return nil, fmt.Errorf("group '%s': %v", g.Name, err)
+		}
+		for _, entries := range [][]Entry{g.Setup, g.Entries, g.Teardown} {
+			for _, e := range entries {
+				if _, err := checkVarNames(e.vars); err != nil {
+					return nil, fmt.Errorf("group '%s', entry '%s': %v", g.Name, e.Name, err)
+				}
+			}
+		}
+
+		// Reserved name coyote is used to set the title and global vars.
+		if g.Name == "coyote" {
+			if g.Title != "" {
+				r.opts.Title = g.Title
+			}
+			if len(vars) != 0 {
+				r.globalVars = vars
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// Title returns the title of the results, the one of the coyote group or of the options.
+func (r *Runner) Title() string {
+	return r.opts.Title
+}
+
+// getGlobalVars returns a copy of the global variables, safe to use while other groups are running.
+func (r *Runner) getGlobalVars() map[string]string {
+	r.globalVarsMu.RLock()
+	defer r.globalVarsMu.RUnlock()
+
+	vars := make(map[string]string, len(r.globalVars))
+	for k, v := range r.globalVars {
+		vars[k] = v
+	}
+	return vars
+}
+
+// setGlobalVar sets the global variable "name", e.g by a `register` with global scope.
+func (r *Runner) setGlobalVar(name, value string) {
+	r.globalVarsMu.Lock()
+	r.globalVars["%"+name+"%"] = value
+	r.globalVarsMu.Unlock()
+}
+
+// uniques generates the values of the %UNIQUE% and %UNIQUE_name% vars.
+// The named ones keep their value for as long as the uniques are used, i.e a whole run.
+type uniques struct {
+	mu    sync.Mutex // protects named and the generation of unique values.
+	named map[string]string
+}
+
+func newUniques() *uniques {
+	return &uniques{named: make(map[string]string)}
+}
+
+// replace replaces instances of %UNIQUE% with a unique string based on current millisecond.
+func (u *uniques) replace(s string) (result string) {
+	var contain = true
+	result = s
+	for {
+		switch contain {
+		case true:
+			if strings.Contains(result, "%UNIQUE%") { // Single use unique var
+				u.mu.Lock()
+				uniqueText := nextUnique()
+				u.mu.Unlock()
+				result = strings.Replace(result, "%UNIQUE%", uniqueText, 1)
+			} else if uniqRegexp.MatchString(result) { // Multi use unique var
+				stringsToReplace := uniqRegexp.FindAllString(result, -1)
+				u.mu.Lock()
+				u.assignMultiUse(stringsToReplace)
+				for _, v := range stringsToReplace { // This may run more times than needed but it doesn't affect run times.
+					result = strings.Replace(result, v, u.named[v], -1)
+				}
+				u.mu.Unlock()
+			} else {
+				contain = false
+			}
+		case false:
+			return
+		}
+	}
+}
+
+// nextUnique returns a unique string based on the current millisecond.
+// The caller must hold the lock of the uniques, so concurrent groups never receive the same value.
+func nextUnique() string {
+	t := time.Now().UnixNano()
+	t = t / 1e6 // Keep millisecond
+	time.Sleep(time.Millisecond)
+	return fmt.Sprintf("%d", t)
+}
+
+// assignMultiUse generates the values of the named unique vars that are not set yet.
+// The caller must hold u.mu.
+func (u *uniques) assignMultiUse(matches []string) {
+	for _, v := range matches {
+		if _, exists := u.named[v]; !exists {
+			u.named[v] = nextUnique()
+		}
+	}
+}
+
+// recurseClean cleans a []string from one or more empty entries at the start of the array.
+func recurseClean(t []string) []string {
+	if len(t) > 0 {
+		if len(t[0]) == 0 {
+			return recurseClean(t[1:])
+		}
+	}
+	return t
+}
+
+// checkVarNames verifies that variable names are within acceptable criteria
+// and returns a new map where keys are enclosed within ampersands
+// so we can check for %VARNAME% entries.
+func checkVarNames(vars map[string]string) (map[string]string, error) {
+	r := make(map[string]string)
+	for k, v := range vars {
+		test := acceptableVarName.MatchString(k)
+		if test != true {
+			return r, errors.New("Variable name '" + k + "' contains illegal characters. Only alphanumerics and underscore are permitted for var names.")
+		}
+		test = uniqRegexp.MatchString("%" + k + "%")
+		if test == true {
+			return r, errors.New("Variable name '" + k + "' matches UNIQUE keyword for autogenerated values.")
+		}
+		if strings.Compare(k, "UNIQUE") == 0 {
+			return r, errors.New("Variable name 'UNIQUE' is reserved.")
+		}
+		r["%"+k+"%"] = v
+	}
+	return r, nil
+}
+
+// replaceVars searches and replaces local and global variables in a string
+// localVars have precedence over globalVars
+func replaceVars(text string, localVars map[string]string, globalVars map[string]string) string {
+	for k, v := range localVars {
+		text = strings.Replace(text, k, v, -1)
+	}
+	for k, v := range globalVars {
+		text = strings.Replace(text, k, v, -1)
+	}
+	return text
+}
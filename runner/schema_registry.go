@@ -0,0 +1,288 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// SchemaRegistryStep talks to a schema registry instead of running a command, so the schemas are kept in files
+	// instead of being escaped inside curl commands. It runs at most one of its actions, the response of the action
+	// is the stdout of the entry, then it checks its `SubjectExists` assertion.
+	SchemaRegistryStep struct {
+		URL         string         `yaml:"url"`
+		BasicAuth   *HTTPBasicAuth `yaml:"basic_auth,omitempty"`
+		BearerToken string         `yaml:"bearer_token,omitempty"`
+		TLS         *TLSOptions    `yaml:"tls,omitempty"`
+
+		// Register registers the schema under its subject, the response has its id, i.e `{"id": 1}`.
+		// If it has a `CompatibleWith` version the schema is checked against it first.
+		Register *SchemaRegistrySchema `yaml:"register,omitempty"`
+		// CheckCompatibility fails if the schema is not compatible with the `CompatibleWith` version of its subject,
+		// which defaults to the latest one.
+		CheckCompatibility *SchemaRegistrySchema `yaml:"check_compatibility,omitempty"`
+		// Fetch fetches a version of a subject, the response has its schema.
+		Fetch *SchemaRegistryVersion `yaml:"fetch,omitempty"`
+		// ListSubjects lists the subjects, the response is an array of their names.
+		ListSubjects bool `yaml:"list_subjects,omitempty"`
+		// ListVersions lists the versions of a subject, the response is an array of their numbers.
+		ListVersions string `yaml:"list_versions,omitempty"`
+
+		// SubjectExists are subjects that should exist.
+		SubjectExists []string `yaml:"subject_exists,omitempty"`
+	}
+
+	// SchemaRegistrySchema is a schema of a subject.
+	SchemaRegistrySchema struct {
+		Subject string `yaml:"subject"`
+		// Schema is the schema, or SchemaFile the file to read it from, relative to the `WorkDir` of the entry.
+		Schema     string `yaml:"schema,omitempty"`
+		SchemaFile string `yaml:"schema_file,omitempty"`
+		// SchemaType is AVRO (the default), JSON or PROTOBUF.
+		SchemaType string `yaml:"schema_type,omitempty"`
+		// CompatibleWith is the version of the subject the schema should be compatible with, `latest` or a number.
+		// A register skips the check if the subject has no versions yet.
+		CompatibleWith string `yaml:"compatible_with,omitempty"`
+	}
+
+	// SchemaRegistryVersion is a version of a subject.
+	SchemaRegistryVersion struct {
+		Subject string `yaml:"subject"`
+		// Version is `latest` (the default) or a number.
+		Version string `yaml:"version,omitempty"`
+	}
+)
+
+// schemaRegistryActions are the yaml fields of the actions of a `SchemaRegistryStep`, it runs at most one of them.
+var schemaRegistryActions = []string{"register", "check_compatibility", "fetch", "list_subjects", "list_versions"}
+
+// schemaRegistryContentType is the content type of the requests to a schema registry.
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+// schemaRegistrySubjectNotFound is the error code of a schema registry for a subject without versions.
+const schemaRegistrySubjectNotFound = 40401
+
+// String describes the action of the step, i.e `schema registry register coyote_test_avro-value`.
+func (s *SchemaRegistryStep) String() string {
+	switch {
+	case s.Register != nil:
+		return "schema registry register " + s.Register.Subject
+	case s.CheckCompatibility != nil:
+		return fmt.Sprintf("schema registry check compatibility of %s with version %s",
+			s.CheckCompatibility.Subject, s.CheckCompatibility.compatibleWith())
+	case s.Fetch != nil:
+		return fmt.Sprintf("schema registry fetch %s version %s", s.Fetch.Subject, s.Fetch.version())
+	case s.ListSubjects:
+		return "schema registry list subjects"
+	case s.ListVersions != "":
+		return "schema registry list versions of " + s.ListVersions
+	default:
+		return "schema registry subjects exist: " + strings.Join(s.SubjectExists, ", ")
+	}
+}
+
+func (v *SchemaRegistryVersion) version() string {
+	if v.Version == "" {
+		return "latest"
+	}
+	return v.Version
+}
+
+func (s *SchemaRegistrySchema) compatibleWith() string {
+	if s.CompatibleWith == "" {
+		return "latest"
+	}
+	return s.CompatibleWith
+}
+
+// run runs the action of the step, writes its response to "stdout" and the requests to "stderr",
+// then checks that the `SubjectExists` subjects exist.
+func (s *SchemaRegistryStep) run(ctx context.Context, v Entry, stdout, stderr io.Writer) error {
+	switch {
+	case s.Register != nil:
+		if s.Register.CompatibleWith != "" {
+			// The first version of a subject has nothing to be compatible with.
+			var apiErr *restError
+			err := s.checkCompatibility(ctx, v, s.Register, ioutil.Discard, stderr)
+			if err != nil && !(errors.As(err, &apiErr) && apiErr.ErrorCode == schemaRegistrySubjectNotFound) {
+				return err
+			}
+		}
+		body, err := s.Register.body(v.WorkDir)
+		if err != nil {
+			return err
+		}
+		if _, err := s.send(ctx, v, http.MethodPost, "subjects/"+url.PathEscape(s.Register.Subject)+"/versions", body, stdout, stderr); err != nil {
+			return err
+		}
+	case s.CheckCompatibility != nil:
+		if err := s.checkCompatibility(ctx, v, s.CheckCompatibility, stdout, stderr); err != nil {
+			return err
+		}
+	case s.Fetch != nil:
+		path := "subjects/" + url.PathEscape(s.Fetch.Subject) + "/versions/" + url.PathEscape(s.Fetch.version())
+		if _, err := s.send(ctx, v, http.MethodGet, path, "", stdout, stderr); err != nil {
+			return err
+		}
+	case s.ListSubjects:
+		if _, err := s.send(ctx, v, http.MethodGet, "subjects", "", stdout, stderr); err != nil {
+			return err
+		}
+	case s.ListVersions != "":
+		if _, err := s.send(ctx, v, http.MethodGet, "subjects/"+url.PathEscape(s.ListVersions)+"/versions", "", stdout, stderr); err != nil {
+			return err
+		}
+	}
+
+	if len(s.SubjectExists) == 0 {
+		return nil
+	}
+	b, err := s.send(ctx, v, http.MethodGet, "subjects", "", ioutil.Discard, stderr)
+	if err != nil {
+		return err
+	}
+	var subjects []string
+	if err := json.Unmarshal(b, &subjects); err != nil {
+		return fmt.Errorf("bad list of subjects: %v", err)
+	}
+	exists := make(map[string]bool, len(subjects))
+	for _, subject := range subjects {
+		exists[subject] = true
+	}
+	for _, subject := range s.SubjectExists {
+		if !exists[subject] {
+			return fmt.Errorf("subject '%s' does not exist", subject)
+		}
+	}
+	return nil
+}
+
+// checkCompatibility fails if the "schema" is not compatible with its `CompatibleWith` version,
+// with the reasons of the registry if it gives any.
+func (s *SchemaRegistryStep) checkCompatibility(ctx context.Context, v Entry, schema *SchemaRegistrySchema, stdout, stderr io.Writer) error {
+	body, err := schema.body(v.WorkDir)
+	if err != nil {
+		return err
+	}
+	path := "compatibility/subjects/" + url.PathEscape(schema.Subject) + "/versions/" + url.PathEscape(schema.compatibleWith()) + "?verbose=true"
+	b, err := s.send(ctx, v, http.MethodPost, path, body, stdout, stderr)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		IsCompatible bool     `json:"is_compatible"`
+		Messages     []string `json:"messages"`
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return fmt.Errorf("bad compatibility response: %v", err)
+	}
+	if !result.IsCompatible {
+		msg := fmt.Sprintf("schema is not compatible with version %s of subject '%s'", schema.compatibleWith(), schema.Subject)
+		if len(result.Messages) > 0 {
+			msg += ": " + strings.Join(result.Messages, "; ")
+		}
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// body returns the request body of the schema, with the schema read from its file.
+func (s *SchemaRegistrySchema) body(workDir string) (string, error) {
+	schema := s.Schema
+	if s.SchemaFile != "" {
+		file := s.SchemaFile
+		if workDir != "" && !filepath.IsAbs(file) {
+			file = filepath.Join(workDir, file)
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		schema = string(b)
+	}
+
+	request := struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType,omitempty"`
+	}{Schema: schema}
+	// The registries that only know of AVRO do not accept a schema type.
+	if t := strings.ToUpper(s.SchemaType); t != "" && t != "AVRO" {
+		request.SchemaType = t
+	}
+	b, err := json.Marshal(request)
+	return string(b), err
+}
+
+// send sends a request to the "path" of the registry and returns the body of its response.
+func (s *SchemaRegistryStep) send(ctx context.Context, v Entry, method, path, body string, stdout, stderr io.Writer) ([]byte, error) {
+	c := restClient{URL: s.URL, BasicAuth: s.BasicAuth, BearerToken: s.BearerToken, TLS: s.TLS, ContentType: schemaRegistryContentType}
+	return c.send(ctx, v, method, path, body, stdout, stderr)
+}
+
+// mapVars returns the step with the local and global vars mapped to its url, credentials, subjects and schemas.
+func (s *SchemaRegistryStep) mapVars(localVars, globalVars map[string]string, u *uniques) *SchemaRegistryStep {
+	if s == nil {
+		return nil
+	}
+
+	mapped := *s
+	mapped.URL = replaceVars(s.URL, localVars, globalVars)
+	mapped.BearerToken = replaceVars(s.BearerToken, localVars, globalVars)
+	if s.BasicAuth != nil {
+		mapped.BasicAuth = &HTTPBasicAuth{
+			Username: replaceVars(s.BasicAuth.Username, localVars, globalVars),
+			Password: replaceVars(s.BasicAuth.Password, localVars, globalVars),
+		}
+	}
+	mapped.TLS = s.TLS.mapVars(localVars, globalVars)
+
+	mapSchema := func(schema *SchemaRegistrySchema) *SchemaRegistrySchema {
+		if schema == nil {
+			return nil
+		}
+		m := *schema
+		m.Subject = replaceVars(u.replace(schema.Subject), localVars, globalVars)
+		m.Schema = replaceVars(u.replace(schema.Schema), localVars, globalVars)
+		m.SchemaFile = replaceVars(schema.SchemaFile, localVars, globalVars)
+		m.CompatibleWith = replaceVars(schema.CompatibleWith, localVars, globalVars)
+		return &m
+	}
+	mapped.Register = mapSchema(s.Register)
+	mapped.CheckCompatibility = mapSchema(s.CheckCompatibility)
+	if s.Fetch != nil {
+		mapped.Fetch = &SchemaRegistryVersion{
+			Subject: replaceVars(u.replace(s.Fetch.Subject), localVars, globalVars),
+			Version: replaceVars(s.Fetch.Version, localVars, globalVars),
+		}
+	}
+	mapped.ListVersions = replaceVars(u.replace(s.ListVersions), localVars, globalVars)
+	if s.SubjectExists != nil {
+		mapped.SubjectExists = make([]string, len(s.SubjectExists))
+		for i, subject := range s.SubjectExists {
+			mapped.SubjectExists[i] = replaceVars(u.replace(subject), localVars, globalVars)
+		}
+	}
+	return &mapped
+}
@@ -0,0 +1,260 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSchemaRegistry is a stand-in schema registry that keeps the schemas of its subjects in memory.
+// A schema is compatible with another one if it has all of its fields.
+type fakeSchemaRegistry struct {
+	mu       sync.Mutex
+	subjects map[string][]string
+}
+
+func (f *fakeSchemaRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", schemaRegistryContentType)
+	fail := func(status, code int, message string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error_code": code, "message": message})
+	}
+	if user, password, _ := r.BasicAuth(); user != "coyote" || password != "secret" {
+		fail(http.StatusUnauthorized, 40101, "Unauthorized")
+		return
+	}
+
+	var request struct {
+		Schema string `json:"schema"`
+	}
+	if r.Method == http.MethodPost {
+		if r.Header.Get("Content-Type") != schemaRegistryContentType {
+			fail(http.StatusUnsupportedMediaType, 415, "Unsupported Media Type")
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fail(http.StatusUnprocessableEntity, 42201, "Invalid schema")
+			return
+		}
+	}
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if path[0] == "compatibility" {
+		path = path[1:]
+	}
+	if path[0] != "subjects" {
+		fail(http.StatusNotFound, 404, "HTTP 404 Not Found")
+		return
+	}
+	if len(path) == 1 {
+		subjects := make([]string, 0, len(f.subjects))
+		for subject := range f.subjects {
+			subjects = append(subjects, subject)
+		}
+		sort.Strings(subjects)
+		json.NewEncoder(w).Encode(subjects)
+		return
+	}
+
+	subject := path[1]
+	versions, ok := f.subjects[subject]
+	if !ok && (r.Method != http.MethodPost || len(path) > 3) {
+		fail(http.StatusNotFound, 40401, fmt.Sprintf("Subject '%s' not found.", subject))
+		return
+	}
+	if len(path) == 3 {
+		if r.Method == http.MethodPost {
+			f.subjects[subject] = append(versions, request.Schema)
+			json.NewEncoder(w).Encode(map[string]int{"id": len(f.subjects[subject])})
+			return
+		}
+		numbers := make([]int, len(versions))
+		for i := range versions {
+			numbers[i] = i + 1
+		}
+		json.NewEncoder(w).Encode(numbers)
+		return
+	}
+
+	version := len(versions)
+	if path[3] != "latest" {
+		version, _ = strconv.Atoi(path[3])
+	}
+	if version < 1 || version > len(versions) {
+		fail(http.StatusNotFound, 40402, fmt.Sprintf("Version %s not found.", path[3]))
+		return
+	}
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"subject": subject, "version": version, "id": version, "schema": versions[version-1],
+		})
+		return
+	}
+
+	var old, new struct {
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	}
+	json.Unmarshal([]byte(versions[version-1]), &old)
+	json.Unmarshal([]byte(request.Schema), &new)
+	var messages []string
+	for _, o := range old.Fields {
+		found := false
+		for _, n := range new.Fields {
+			found = found || n.Name == o.Name
+		}
+		if !found {
+			messages = append(messages, fmt.Sprintf("field '%s' is missing", o.Name))
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"is_compatible": len(messages) == 0, "messages": messages})
+}
+
+func TestRunSchemaRegistry(t *testing.T) {
+	srv := httptest.NewServer(&fakeSchemaRegistry{subjects: make(map[string][]string)})
+	defer srv.Close()
+
+	dir := t.TempDir()
+	schemas := map[string]string{
+		"user-v1.avsc": `{"type": "record", "name": "User", "fields": [{"name": "name", "type": "string"}]}`,
+		"user-v2.avsc": `{"type": "record", "name": "User", "fields": [{"name": "name", "type": "string"}, {"name": "age", "type": "int", "default": 0}]}`,
+		"user-v3.avsc": `{"type": "record", "name": "User", "fields": [{"name": "age", "type": "int"}]}`,
+	}
+	for name, schema := range schemas {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(schema), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	yamlContents := []byte(fmt.Sprintf(`
+- name: Schema Registry
+  vars:
+    URL: %s
+    PASSWORD: secret
+  entries:
+    - name: Register
+      workdir: %s
+      schema_registry:
+        url: "%%URL%%"
+        basic_auth: { username: coyote, password: "%%PASSWORD%%" }
+        register: { subject: users-value, schema_file: user-v1.avsc, compatible_with: latest }
+      stdout:
+        - json:
+            - path: $.id
+              equals: 1
+    - name: Register compatible
+      workdir: %s
+      schema_registry:
+        url: "%%URL%%"
+        basic_auth: { username: coyote, password: "%%PASSWORD%%" }
+        register: { subject: users-value, schema_file: user-v2.avsc, compatible_with: latest }
+    - name: Incompatible
+      workdir: %s
+      schema_registry:
+        url: "%%URL%%"
+        basic_auth: { username: coyote, password: "%%PASSWORD%%" }
+        check_compatibility: { subject: users-value, schema_file: user-v3.avsc }
+    - name: Fetch
+      schema_registry:
+        url: "%%URL%%"
+        basic_auth: { username: coyote, password: "%%PASSWORD%%" }
+        fetch: { subject: users-value, version: 1 }
+      stdout:
+        - json:
+            - path: $.schema
+              match: '"name": "name"'
+            - path: $.version
+              equals: 1
+    - name: Subjects
+      schema_registry:
+        url: "%%URL%%"
+        basic_auth: { username: coyote, password: "%%PASSWORD%%" }
+        list_subjects: true
+        subject_exists: [ users-value ]
+      stdout:
+        - json:
+            - path: $[0]
+              equals: users-value
+    - name: Versions
+      schema_registry:
+        url: "%%URL%%"
+        basic_auth: { username: coyote, password: "%%PASSWORD%%" }
+        list_versions: users-value
+      stdout_has: [ '^\[1,2\]' ]
+    - name: Missing subject
+      schema_registry:
+        url: "%%URL%%"
+        basic_auth: { username: coyote, password: "%%PASSWORD%%" }
+        subject_exists: [ users-value, orders-value ]
+    - name: Missing version
+      schema_registry:
+        url: "%%URL%%"
+        basic_auth: { username: coyote, password: "%%PASSWORD%%" }
+        fetch: { subject: users-value, version: 3 }
+    - name: Unauthorized
+      schema_registry:
+        url: "%%URL%%"
+        list_subjects: true`, srv.URL, dir, dir, dir))
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ status, exit string }{
+		{"ok", "0"},
+		{"ok", "0"},
+		{"error", "schema is not compatible with version latest of subject 'users-value': field 'name' is missing"},
+		{"ok", "0"},
+		{"ok", "0"},
+		{"ok", "0"},
+		{"error", "subject 'orders-value' does not exist"},
+		{"error", "status 404: Version 3 not found. (error code 40402)"},
+		{"error", "status 401: Unauthorized (error code 40101)"},
+	}
+	results := data.Results[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results but got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i].Status != e.status || results[i].Exit != e.exit {
+			t.Fatalf("[%d] expected status '%s' and exit '%s' but got '%s' and '%s': %s", i, e.status, e.exit,
+				results[i].Status, results[i].Exit, strings.Join(results[i].Stderr, "\n"))
+		}
+	}
+
+	if command := results[2].Command; command != "schema registry check compatibility of users-value with version latest" {
+		t.Fatalf("expected the step to be described as a command but got '%s'", command)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// step is what an entry runs in-process instead of a command, i.e an http request.
+// Its outputs go through the same assertions, registers and retries as the ones of a command.
+type step interface {
+	// run runs one attempt of the step of the entry "v" and writes its outputs to "stdout" and "stderr".
+	// Its error fails the attempt like a failed command. "ctx" is done on the timeout of the entry.
+	run(ctx context.Context, v Entry, stdout, stderr io.Writer) error
+	// String describes the step in place of a command, i.e `GET http://localhost:8082/topics`.
+	String() string
+}
+
+// step returns the step of the entry, or nil if it runs a command.
+func (e *Entry) step() step {
+	switch {
+	case e.HTTP != nil:
+		return e.HTTP
+	case e.Kafka != nil:
+		return e.Kafka
+	case e.SchemaRegistry != nil:
+		return e.SchemaRegistry
+	case e.Connect != nil:
+		return e.Connect
+	case e.WaitFor != nil:
+		return e.WaitFor
+	default:
+		return nil
+	}
+}
+
+// stepFields are the yaml fields of the steps, an entry has either one of them or a command.
+var stepFields = []string{"http", "kafka", "schema_registry", "connect", "wait_for"}
+
+// execStep runs the step "s" of the entry "v", like `execEntry` runs a command.
+func (r *Runner) execStep(ctx context.Context, v Entry, s step, stdout, stderr io.Writer) (timerLive, interrupted bool, elapsed time.Duration, err error) {
+	stepCtx, cancel := context.WithTimeout(ctx, v.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err = s.run(stepCtx, v, stdout, stderr)
+	elapsed = time.Since(start)
+
+	timerLive = true
+	switch {
+	case ctx.Err() == context.Canceled:
+		interrupted = true
+	case stepCtx.Err() == context.DeadlineExceeded:
+		timerLive = false
+	}
+	return timerLive, interrupted, elapsed, err
+}
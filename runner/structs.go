@@ -0,0 +1,81 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+type Result struct {
+	Name    string
+	Command string
+	Status  string
+	Time    float64
+	Stdout  []string
+	Stderr  []string
+	Exit    string
+	// SkipReason is why the entry was skipped, e.g `skip: true`, if its status is "skipped".
+	SkipReason string `json:",omitempty"`
+	// Signal is the signal that terminated the command, if any, e.g `SIGTERM` after a timeout.
+	Signal string `json:",omitempty"`
+	// StdoutFile and StderrFile are the files with the whole outputs, if saved, see `Options.ArtifactsDir`.
+	StdoutFile string `json:",omitempty"`
+	StderrFile string `json:",omitempty"`
+	// ReadyTime is how many seconds the `WaitFor` step of the entry took to become ready since its first attempt, if it did.
+	ReadyTime float64 `json:",omitempty"`
+	Test      Entry
+	// Attempts holds every run of an entry with retries, the last one is the result itself.
+	Attempts []Attempt `json:",omitempty"`
+}
+
+// Attempt is a single run of an entry that was retried.
+type Attempt struct {
+	Status string
+	Time   float64
+	Stdout []string
+	Stderr []string
+	Exit   string
+}
+
+type ResultGroup struct {
+	Name    string
+	Type    string
+	Results []Result
+	Passed  int
+	Errors  int
+	// Skipped is the number of skipped entries, they are not part of the `Total`.
+	Skipped   int
+	Total     int
+	TotalTime float64
+	// Setup and Teardown are the results of the setup and the teardown entries of the group,
+	// they are not part of the counts above.
+	Setup    []Result `json:",omitempty"`
+	Teardown []Result `json:",omitempty"`
+	// FixtureErrors is the number of the setup and teardown entries that failed.
+	FixtureErrors int `json:",omitempty"`
+	// SkipReason is why the whole group was skipped, i.e a group it depends on failed, if it was.
+	SkipReason string `json:",omitempty"`
+}
+
+type ExportData struct {
+	Results    []ResultGroup
+	Errors     int
+	Successful int
+	// Skipped is the number of skipped entries, they are not part of the `TotalTests`.
+	Skipped    int
+	TotalTests int
+	TotalTime  float64
+	Date       string
+	Title      string
+	// FixtureErrors is the number of the setup and teardown entries that failed, see `ResultGroup`.
+	FixtureErrors int `json:",omitempty"`
+	// Interrupted is true if the run was cancelled, i.e by SIGINT, and the results are partial.
+	Interrupted bool `json:",omitempty"`
+}
@@ -1,17 +1,4 @@
-// Copyright 2016-2021, Lenses.io Ltd
-//
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
-//     http://www.apache.org/licenses/LICENSE-2.0
-//
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
-
-package main
+package runner
 
 const (
 	mainTemplate = `<html lang="en">
@@ -23,10 +10,20 @@ const (
     <link rel="stylesheet" href="//ajax.googleapis.com/ajax/libs/angular_material/1.1.0/angular-material.min.css">
 
 
-    <script src="//use.fontawesome.com/fbbd91a770.js"></script>
-
     <style>
         body { background-color:#f4f4f4;}
+
+        /* The icons of the report, as characters so they need no icon font from the network. */
+        .fa { display:inline-block; font-style:normal; font-weight:bold; }
+        .fa-check:before { content:"\2714"; }
+        .fa-times:before { content:"\2716"; }
+        .fa-minus:before { content:"\2212"; }
+        .fa-angle-double-up:before { content:"\21C8"; }
+        .fa-angle-double-down:before { content:"\21CA"; }
+        .fa-caret-up:before { content:"\25B4"; }
+        .fa-caret-down:before { content:"\25BE"; }
+        .fa-clock-o:before { content:"\25F7"; }
+        .fa-terminal:before { content:">_"; font-family:monospace; }
         h1, h2, h3, h4 { font-weight:200 }
 
 
@@ -59,6 +56,8 @@ const (
         .icon-status-header-failed {width:20px; margin:10px; font-size:20px; color:red}
         .icon-status-passed {width:10px; color:green}
         .icon-status-failed {width:10px; color:red}
+        .icon-status-not-run {width:10px; color:#999}
+        .icon-status-skipped {width:10px; color:#999}
         .summary {font-size:14; padding-right:10px;}
         .dark-background {background-color:#2b2b2b; color: #ccc;}
         .logo-section {padding-left:30px;}
@@ -105,7 +104,8 @@ const (
             <div flex="35" layout="column">
                 <div class="box">
                     <h4> <b>{{ percentsucc | number:2 }}%</b> Passed</h4>
-                    <h6 style="margin-top:-15px;"> Total tests: {{datalist.TotalTests}} </h6>
+                    <h6 style="margin-top:-15px;"> Total tests: {{datalist.TotalTests}} <span ng-show="datalist.Skipped > 0">| Skipped: {{datalist.Skipped}} </span></h6>
+                    <h6 style="margin-top:-15px; color:red;" ng-show="datalist.Interrupted"> Interrupted, the results are partial </h6>
                 </div>
 
                 <md-content class="testlist">
@@ -119,7 +119,7 @@ const (
                             </i>
                             <div class="md-list-item-text" layout="column">
                                 <h3 style="color:#fff;">{{d.Name}}</h3>
-                                <p style="color:#ccc; padding-top: 5px;">Passed {{ d.Passed }} out of {{ d.Total }} | {{d.TotalTime | number:2}}s  </p>
+                                <p style="color:#ccc; padding-top: 5px;">Passed {{ d.Passed }} out of {{ d.Total }} <span ng-show="d.Skipped > 0">| skipped {{ d.Skipped }} </span>| {{d.TotalTime | number:2}}s  </p>
                             </div>
                         <md-divider ></md-divider>
                         </md-list-item>
@@ -146,7 +146,7 @@ const (
                 <md-card-header class="dark-background md-title" ng-click="toggleCard(cardIndex); totalheight()" style="padding-top: 6px; padding-bottom: 6px;">
                     <md-card-avatar layout-align="center start ">
                         <i style="margin-top:10px"
-                           ng-class="{ 'fa fa-times icon-status-failed': test.Errors > 0, 'fa fa-check icon-status-passed': test.Errors == 0,  }" aria-hidden="true">
+                           ng-class="{ 'fa fa-times icon-status-failed': test.Errors > 0 || test.FixtureErrors > 0, 'fa fa-check icon-status-passed': test.Errors == 0 && !test.FixtureErrors,  }" aria-hidden="true">
                         </i>
                     </md-card-avatar>
                     <md-card-header-text layout-align="center start">
@@ -177,16 +177,16 @@ const (
                                 <i class="fa fa-caret-up" aria-hidden="true" ng-show="showRow[rowIndex+''+cardIndex]"></i>
                             </td>
                             <td>
-                                <i ng-class="{ 'fa fa-times icon-status-failed': dtest.Status == 'error', 'fa fa-check icon-status-passed': dtest.Status == 'ok',  }" aria-hidden="true"></i>
+                                <i ng-class="{ 'fa fa-times icon-status-failed': dtest.Status != 'ok' && dtest.Status != 'not run' && dtest.Status != 'skipped', 'fa fa-check icon-status-passed': dtest.Status == 'ok', 'fa fa-minus icon-status-not-run': dtest.Status == 'not run', 'fa fa-minus icon-status-skipped': dtest.Status == 'skipped' }" aria-hidden="true"></i>
                             </td>
                             <td><b>{{dtest.Name}}</b></td>
-                            <td> {{dtest.Time | number:2}}</td>
+                            <td> {{dtest.Time | number:2}}<span ng-show="dtest.ReadyTime"> (ready after {{dtest.ReadyTime | number:2}})</span></td>
                             <td hide-sm hide-xs>
                                 <code>
                                     {{dtest.Command}}
                                 </code>
                             </td>
-                            <td>{{dtest.Exit}}</td>
+                            <td>{{dtest.Exit}}<span ng-show="dtest.SkipReason"> ({{dtest.SkipReason}})</span></td>
                         </tr>
                         <tr>
                             <td colspan="6" ng-show="showRow[rowIndex+''+cardIndex]" class="td-hidden">
@@ -215,6 +215,23 @@ const (
 											</span>
                                     </code>
                                 </div>
+
+                                <h4 ng-show="dtest.StdoutFile || dtest.StderrFile">Full Output</h4>
+                                <div ng-click="$event.stopPropagation();" ng-show="dtest.StdoutFile || dtest.StderrFile">
+                                    <a ng-show="dtest.StdoutFile" ng-href="{{dtest.StdoutFile}}" target="_blank">stdout</a>
+                                    <a ng-show="dtest.StderrFile" ng-href="{{dtest.StderrFile}}" target="_blank">stderr</a>
+                                </div>
+
+                                <h4 ng-show="dtest.Attempts.length > 1">Attempts</h4>
+                                <div style="cursor:text" ng-click="$event.stopPropagation();" ng-repeat="attempt in dtest.Attempts track by $index" ng-show="dtest.Attempts.length > 1"
+                                     ng-class="{ 'td-hidden-std': attempt.Status == 'ok', 'td-hidden-error': attempt.Status != 'ok' }">
+                                    <b>#{{$index + 1}}</b> {{attempt.Status}} | exit code {{attempt.Exit}} | {{attempt.Time | number:2}}s<br />
+                                    <code>
+											<span ng-repeat="line in attempt.Stdout.concat(attempt.Stderr) track by $index" >
+												<span ng-bind-html="consoleStdout(line)" > </span><br />
+											</span>
+                                    </code>
+                                </div>
                             </td>
                         </tr>
 
@@ -222,8 +239,22 @@ const (
                         </tbody>
                     </table>
 
+                    <div style="padding: 0 16px;" ng-repeat="fixtures in [{name: 'Setup', results: test.Setup}, {name: 'Teardown', results: test.Teardown}]" ng-show="fixtures.results.length > 0">
+                        <h4>{{fixtures.name}}</h4>
+                        <div ng-repeat="fixture in fixtures.results track by $index" ng-class="{ 'td-hidden-std': fixture.Status == 'ok', 'td-hidden-error': fixture.Status != 'ok' && fixture.Status != 'skipped' && fixture.Status != 'not run' }">
+                            <i ng-class="{ 'fa fa-times icon-status-failed': fixture.Status != 'ok' && fixture.Status != 'not run' && fixture.Status != 'skipped', 'fa fa-check icon-status-passed': fixture.Status == 'ok', 'fa fa-minus icon-status-skipped': fixture.Status == 'not run' || fixture.Status == 'skipped' }" aria-hidden="true"></i>
+                            <b>{{fixture.Name}}</b> | {{fixture.Status}} | exit code {{fixture.Exit}} | {{fixture.Time | number:2}}s<br />
+                            <code>{{fixture.Command}}</code>
+                            <code ng-show="fixture.Status != 'ok'"><br />
+                                <span ng-repeat="line in fixture.Stdout.concat(fixture.Stderr) track by $index" >
+                                    <span ng-bind-html="consoleStdout(line)" > </span><br />
+                                </span>
+                            </code>
+                        </div>
+                    </div>
+
                     <div layout="row" layout-align="end center">
-                        <p class="summary">Passed {{test.Passed}} out of {{test.Total}} | {{test.TotalTime | number:2}} seconds </p>
+                        <p class="summary">Passed {{test.Passed}} out of {{test.Total}} <span ng-show="test.Skipped > 0">| skipped {{test.Skipped}} </span>| {{test.TotalTime | number:2}} seconds </p>
                     </div>
                 </md-content>
             </md-card>
@@ -236,8 +267,8 @@ const (
 
 <h6 id="#results" class="footer-github">Report Issues & Stars!</h6>
 <div flex layout="row" layout-align="center center">
-    <a class="github-button" href="https://github.com/Landoop/coyote/issues" data-count-api="/repos/Landoop/coyote#open_issues_count" data-count-aria-label="# issues on GitHub" aria-label="Issue Landoop/coyote on GitHub">Issue</a>
-    <a class="github-button" href="https://github.com/Landoop/coyote" data-count-href="/Landoop/coyote/stargazers" data-count-api="/repos/Landoop/coyote#stargazers_count" data-count-aria-label="# stargazers on GitHub" aria-label="Star Landoop/coyote on GitHub">Star</a>
+    <md-button class="md-raised" href="https://github.com/Landoop/coyote/issues" target="_blank" aria-label="Issue Landoop/coyote on GitHub">Issue</md-button>
+    <md-button class="md-raised" href="https://github.com/Landoop/coyote" target="_blank" aria-label="Star Landoop/coyote on GitHub">Star</md-button>
 </div>
 
 <div flex layout="row" layout-align="center center">
@@ -258,9 +289,6 @@ const (
 <script src="//storage.googleapis.com/wch/ansi_up-1.3.0.js" type="text/javascript"></script>
 
 
-<script async defer src="//buttons.github.io/buttons.js"></script>
-
-
 <script type="text/javascript">
 
      angular.module('CoyoteApp', ['ngMaterial', 'ngAnimate', 'ngAria'])
@@ -0,0 +1,80 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// TLSOptions configure the TLS connections of the steps of the entries, i.e of an http request.
+// The files are relative to the `WorkDir` of the entry.
+type TLSOptions struct {
+	// CACert is a PEM file with the certificates to verify the server with, instead of the ones of the system.
+	CACert string `yaml:"ca_cert,omitempty"`
+	// Cert and Key are the PEM files of the client certificate and its key, if the server asks for one.
+	Cert string `yaml:"cert,omitempty"`
+	Key  string `yaml:"key,omitempty"`
+	// ServerName is the name to verify the certificate of the server with, defaults to the host that is dialed.
+	ServerName string `yaml:"server_name,omitempty"`
+	// InsecureSkipVerify if true does not verify the certificate of the server.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// config returns the TLS configuration of the options, with their files relative to the "workDir".
+func (o *TLSOptions) config(workDir string) (*tls.Config, error) {
+	path := func(file string) string {
+		if workDir == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(workDir, file)
+	}
+
+	config := &tls.Config{ServerName: o.ServerName, InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CACert != "" {
+		pem, err := ioutil.ReadFile(path(o.CACert))
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in ca_cert '%s'", o.CACert)
+		}
+	}
+	if o.Cert != "" || o.Key != "" {
+		cert, err := tls.LoadX509KeyPair(path(o.Cert), path(o.Key))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// mapVars returns the options with the local and global vars mapped to their files and server name.
+func (o *TLSOptions) mapVars(localVars, globalVars map[string]string) *TLSOptions {
+	if o == nil {
+		return nil
+	}
+
+	mapped := *o
+	mapped.CACert = replaceVars(o.CACert, localVars, globalVars)
+	mapped.Cert = replaceVars(o.Cert, localVars, globalVars)
+	mapped.Key = replaceVars(o.Key, localVars, globalVars)
+	mapped.ServerName = replaceVars(o.ServerName, localVars, globalVars)
+	return &mapped
+}
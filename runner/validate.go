@@ -0,0 +1,754 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ValidationIssue is a problem found in a configuration file by `coyote validate`.
+type ValidationIssue struct {
+	File    string
+	Line    int
+	Message string
+	// Warning issues are reported but do not fail the validation.
+	Warning bool
+}
+
+func (issue ValidationIssue) String() string {
+	level := "error"
+	if issue.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", issue.File, issue.Line, level, issue.Message)
+}
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	unmarshalerType = reflect.TypeOf((*interface {
+		UnmarshalYAML(unmarshal func(interface{}) error) error
+	})(nil)).Elem()
+	// varRefRegexp finds the variables referenced as %NAME%.
+	varRefRegexp = regexp.MustCompile(`%[a-zA-Z0-9_]+%`)
+)
+
+type validator struct {
+	file   string
+	issues []ValidationIssue
+	// the variables available to every group, from all files.
+	globalVars map[string]bool
+}
+
+func (v *validator) errorf(node *yamlv3.Node, format string, args ...interface{}) {
+	v.issues = append(v.issues, ValidationIssue{File: v.file, Line: node.Line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(node *yamlv3.Node, format string, args ...interface{}) {
+	v.issues = append(v.issues, ValidationIssue{File: v.file, Line: node.Line, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// Validate checks the configuration "files" without running them and returns all the issues found, sorted by file and line.
+// Unlike the loaders it does not stop on the first problem.
+func Validate(files []string) []ValidationIssue {
+	var (
+		issues []ValidationIssue
+		docs   = make(map[string]*yamlv3.Node)
+		global = make(map[string]bool)
+		groups []groupNode
+	)
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			issues = append(issues, ValidationIssue{File: file, Message: err.Error()})
+			continue
+		}
+
+		var doc yamlv3.Node
+		if err = yamlv3.Unmarshal(data, &doc); err != nil {
+			issues = append(issues, ValidationIssue{File: file, Line: yamlErrorLine(err), Message: err.Error()})
+			continue
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		docs[file] = doc.Content[0]
+		collectGlobalVars(doc.Content[0], global)
+		groups = collectGroups(file, doc.Content[0], groups)
+	}
+	issues = append(issues, checkDependencies(groups)...)
+
+	for _, file := range files {
+		root, ok := docs[file]
+		if !ok {
+			continue
+		}
+
+		v := &validator{file: file, globalVars: global}
+		switch root.Kind {
+		case yamlv3.SequenceNode:
+			v.walk(root, reflect.TypeOf([]EntryGroup{}))
+			for _, group := range root.Content {
+				v.checkVarRefs(group)
+			}
+		case yamlv3.MappingNode:
+			v.walk(root, reflect.TypeOf(Context{}))
+			v.checkVarRefs(root)
+		default:
+			v.errorf(root, "expected a list of groups or a context")
+		}
+		issues = append(issues, v.issues...)
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
+
+var yamlLineRegexp = regexp.MustCompile(`line ([0-9]+)`)
+
+func yamlErrorLine(err error) int {
+	var line int
+	if m := yamlLineRegexp.FindStringSubmatch(err.Error()); m != nil {
+		fmt.Sscan(m[1], &line)
+	}
+	return line
+}
+
+// mappingValue returns the value of "key" inside the mapping "node", or nil.
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func isTrue(node *yamlv3.Node) bool {
+	return node != nil && strings.ToLower(node.Value) == "true"
+}
+
+// collectGlobalVars adds the variables that are available to all groups:
+// the vars of the coyote group, the constants of a context and the registers with global scope.
+func collectGlobalVars(node *yamlv3.Node, vars map[string]bool) {
+	switch node.Kind {
+	case yamlv3.SequenceNode:
+		for _, child := range node.Content {
+			if name := mappingValue(child, "name"); name != nil && name.Value == "coyote" {
+				addMappingKeys(mappingValue(child, "vars"), vars)
+			}
+			collectGlobalVars(child, vars)
+		}
+	case yamlv3.MappingNode:
+		addMappingKeys(mappingValue(node, "constants"), vars)
+		if register := mappingValue(node, "register"); register != nil {
+			for _, r := range register.Content {
+				if scope := mappingValue(r, "scope"); scope != nil && strings.ToLower(scope.Value) == "global" {
+					if name := mappingValue(r, "name"); name != nil {
+						vars[name.Value] = true
+					}
+				}
+			}
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			collectGlobalVars(node.Content[i], vars)
+		}
+	}
+}
+
+func addMappingKeys(node *yamlv3.Node, vars map[string]bool) {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		vars[node.Content[i].Value] = true
+	}
+}
+
+// yamlFields returns the fields of the struct "typ" by their yaml names, including the inlined ones.
+func yamlFields(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("yaml")
+		if tag == "-" || field.PkgPath != "" { // unexported.
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if strings.Contains(tag, ",inline") {
+			for k, t := range yamlFields(field.Type) {
+				fields[k] = t
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// walk checks that the "node" can be decoded to "typ" without unknown fields
+// and runs the checks of the known types.
+func (v *validator) walk(node *yamlv3.Node, typ reflect.Type) {
+	if node.Kind == yamlv3.AliasNode {
+		return
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if reflect.PtrTo(typ).Implements(unmarshalerType) {
+		v.checkCustom(node, typ)
+		return
+	}
+
+	if typ == durationType {
+		v.checkDuration(node)
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if node.Kind != yamlv3.MappingNode {
+			v.errorf(node, "expected a mapping for %s", typ.Name())
+			return
+		}
+		fields := yamlFields(typ)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				v.errorf(key, "unknown field '%s' in %s", key.Value, typ.Name())
+				continue
+			}
+			v.walk(value, fieldType)
+		}
+		v.checkStruct(node, typ)
+	case reflect.Slice:
+		if node.Kind != yamlv3.SequenceNode {
+			if node.Tag == "!!null" {
+				return
+			}
+			v.errorf(node, "expected a list")
+			return
+		}
+		for _, child := range node.Content {
+			v.walk(child, typ.Elem())
+		}
+	case reflect.Map:
+		if node.Kind != yamlv3.MappingNode {
+			if node.Tag == "!!null" {
+				return
+			}
+			v.errorf(node, "expected a mapping")
+			return
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			v.walk(node.Content[i], typ.Elem())
+		}
+	case reflect.Interface:
+	default:
+		if node.Kind != yamlv3.ScalarNode {
+			v.errorf(node, "expected a single value")
+		}
+	}
+}
+
+func (v *validator) checkDuration(node *yamlv3.Node) {
+	if node.Kind != yamlv3.ScalarNode {
+		v.errorf(node, "expected a duration")
+		return
+	}
+	if node.Tag == "!!int" {
+		if node.Value != "0" {
+			v.errorf(node, "duration '%s' has no unit, it means %sns, use e.g '%ss'", node.Value, node.Value, node.Value)
+		}
+		return
+	}
+	if _, err := time.ParseDuration(node.Value); err != nil {
+		v.errorf(node, "bad duration: %v", err)
+	}
+}
+
+func (v *validator) checkCustom(node *yamlv3.Node, typ reflect.Type) {
+	if typ == reflect.TypeOf(ExitCodes{}) {
+		var codes ExitCodes
+		if err := node.Decode(&codes); err != nil {
+			v.errorf(node, "bad exit_code: %v", err)
+			return
+		}
+		if err := codes.validate(); err != nil {
+			v.errorf(node, "%v", err)
+		}
+	}
+	if typ == reflect.TypeOf(ByteSize(0)) {
+		var size ByteSize
+		if err := node.Decode(&size); err != nil {
+			v.errorf(node, "%v", err)
+		}
+	}
+}
+
+func (v *validator) checkRegex(node *yamlv3.Node, field string) {
+	if node == nil {
+		return
+	}
+	values := []*yamlv3.Node{node}
+	if node.Kind == yamlv3.SequenceNode {
+		values = node.Content
+	}
+	for _, value := range values {
+		if _, err := regexp.Compile(value.Value); err != nil {
+			v.errorf(value, "%s: bad regexp: %v", field, err)
+		}
+	}
+}
+
+// checkKafkaTopic reports the action of a kafka step that has no topic.
+func (v *validator) checkKafkaTopic(node *yamlv3.Node) {
+	if topic := mappingValue(node, "topic"); topic == nil || strings.TrimSpace(topic.Value) == "" {
+		v.errorf(node, "kafka action is missing the topic field")
+	}
+}
+
+// checkSubject reports the action of a schema registry step that has no subject.
+func (v *validator) checkSubject(node *yamlv3.Node) {
+	if subject := mappingValue(node, "subject"); subject == nil || strings.TrimSpace(subject.Value) == "" {
+		v.errorf(node, "schema registry action is missing the subject field")
+	}
+}
+
+// checkSchemaVersion reports a version of a subject that is neither latest nor a number.
+func (v *validator) checkSchemaVersion(node *yamlv3.Node, field string) {
+	if node == nil || node.Value == "latest" || varRefRegexp.MatchString(node.Value) {
+		return
+	}
+	if n, err := strconv.Atoi(node.Value); err != nil || n < 1 {
+		v.errorf(node, "%s '%s', expected latest or a version number", field, node.Value)
+	}
+}
+
+func (v *validator) checkVarNames(node *yamlv3.Node) {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if _, err := checkVarNames(map[string]string{node.Content[i].Value: ""}); err != nil {
+			v.errorf(node.Content[i], "%v", err)
+		}
+	}
+}
+
+// checkMatrix checks the var names of the matrix or foreach "node" of the "field"
+// and warns about the vars without values, as nothing runs then.
+func (v *validator) checkMatrix(node *yamlv3.Node, field string) {
+	v.checkVarNames(node)
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if values := node.Content[i+1]; values.Kind == yamlv3.SequenceNode && len(values.Content) == 0 {
+			v.warnf(values, "%s '%s' has no values, nothing runs", field, node.Content[i].Value)
+		}
+	}
+}
+
+// checkStruct runs the checks of the known types, after their fields were walked.
+func (v *validator) checkStruct(node *yamlv3.Node, typ reflect.Type) {
+	switch typ {
+	case reflect.TypeOf(EntryGroup{}), reflect.TypeOf(ContextSpec{}):
+		v.checkVarNames(mappingValue(node, "vars"))
+		v.checkMatrix(mappingValue(node, "matrix"), "matrix")
+		if onFailure := mappingValue(node, "on_failure"); onFailure != nil {
+			if err := checkOnFailure(onFailure.Value); err != nil {
+				v.errorf(onFailure, "%v", err)
+			}
+		}
+	case reflect.TypeOf(Context{}):
+		v.checkVarNames(mappingValue(node, "constants"))
+	case reflect.TypeOf(Entry{}):
+		v.checkMatrix(mappingValue(node, "foreach"), "foreach")
+		command := mappingValue(node, "command")
+		hasCommand := command != nil && strings.TrimSpace(command.Value) != ""
+		step := ""
+		for _, field := range stepFields {
+			if mappingValue(node, field) != nil {
+				step = field
+				break
+			}
+		}
+		if stop := mappingValue(node, "stop"); stop != nil {
+			if hasCommand {
+				v.errorf(command, "entry '%s' stops a background entry, it has no command", mappingValueString(node, "name"))
+			}
+		} else if step != "" {
+			if hasCommand {
+				v.errorf(command, "entry '%s' runs the %s step, it has no command", mappingValueString(node, "name"), step)
+			}
+		} else if !hasCommand {
+			v.errorf(node, "entry '%s' is missing the command field", mappingValueString(node, "name"))
+		}
+		if ready := mappingValue(node, "ready"); ready != nil && !isTrue(mappingValue(node, "background")) {
+			v.warnf(ready, "ready is only used by background entries")
+		}
+		if !isTrue(mappingValue(node, "noregex")) {
+			for _, field := range []string{"stdout_has", "stdout_not_has", "stderr_has", "stderr_not_has"} {
+				v.checkRegex(mappingValue(node, field), field)
+			}
+		}
+		for _, field := range []string{"signal", "kill_signal"} {
+			if signal := mappingValue(node, field); signal != nil {
+				if _, err := parseSignal(signal.Value); err != nil {
+					v.errorf(signal, "%v", err)
+				}
+			}
+		}
+	case reflect.TypeOf(HTTPRequest{}):
+		if url := mappingValue(node, "url"); url == nil || strings.TrimSpace(url.Value) == "" {
+			v.errorf(node, "http request is missing the url field")
+		}
+		if headers := mappingValue(node, "response_headers"); headers != nil {
+			for i := 1; i < len(headers.Content); i += 2 {
+				v.checkRegex(headers.Content[i], "response_headers")
+			}
+		}
+	case reflect.TypeOf(KafkaStep{}):
+		if brokers := mappingValue(node, "brokers"); brokers == nil || strings.TrimSpace(brokers.Value) == "" {
+			v.errorf(node, "kafka step is missing the brokers field")
+		}
+		var actions []string
+		for _, field := range kafkaActions {
+			if mappingValue(node, field) != nil {
+				actions = append(actions, field)
+			}
+		}
+		switch {
+		case len(actions) == 0:
+			v.errorf(node, "kafka step has no action, expected one of %s", strings.Join(kafkaActions, ", "))
+		case len(actions) > 1:
+			v.errorf(mappingValue(node, actions[1]), "kafka step has more than one action: %s", strings.Join(actions, ", "))
+		}
+		protocol, mechanism := mappingValue(node, "security_protocol"), mappingValue(node, "sasl_mechanism")
+		if protocol != nil {
+			if err := checkKafkaSecurity(protocol.Value, ""); err != nil {
+				v.errorf(protocol, "%v", err)
+			}
+		}
+		if mechanism != nil {
+			if err := checkKafkaSecurity("", mechanism.Value); err != nil {
+				v.errorf(mechanism, "%v", err)
+			}
+		}
+	case reflect.TypeOf(SchemaRegistryStep{}):
+		if url := mappingValue(node, "url"); url == nil || strings.TrimSpace(url.Value) == "" {
+			v.errorf(node, "schema registry step is missing the url field")
+		}
+		var actions []string
+		for _, field := range schemaRegistryActions {
+			if mappingValue(node, field) != nil {
+				actions = append(actions, field)
+			}
+		}
+		switch {
+		case len(actions) == 0 && mappingValue(node, "subject_exists") == nil:
+			v.errorf(node, "schema registry step has no action or subject_exists, expected one of %s", strings.Join(schemaRegistryActions, ", "))
+		case len(actions) > 1:
+			v.errorf(mappingValue(node, actions[1]), "schema registry step has more than one action: %s", strings.Join(actions, ", "))
+		}
+	case reflect.TypeOf(ConnectStep{}):
+		if url := mappingValue(node, "url"); url == nil || strings.TrimSpace(url.Value) == "" {
+			v.errorf(node, "connect step is missing the url field")
+		}
+		var actions []string
+		for _, field := range connectActions {
+			if mappingValue(node, field) != nil {
+				actions = append(actions, field)
+			}
+		}
+		switch {
+		case len(actions) == 0:
+			v.errorf(node, "connect step has no action, expected one of %s", strings.Join(connectActions, ", "))
+		case len(actions) > 1:
+			v.errorf(mappingValue(node, actions[1]), "connect step has more than one action: %s", strings.Join(actions, ", "))
+		}
+		if state := mappingValue(node, "state"); state != nil {
+			if err := checkConnectState(state.Value); err != nil {
+				v.errorf(state, "%v", err)
+			} else if mappingValue(node, "delete") != nil {
+				v.errorf(state, "a deleted connector has no state")
+			}
+		}
+	case reflect.TypeOf(WaitFor{}):
+		var targets int
+		for _, field := range waitForTargets {
+			target := mappingValue(node, field)
+			if target == nil {
+				continue
+			}
+			targets++
+			if (field == "tcp" || field == "tls") && !varRefRegexp.MatchString(target.Value) {
+				if _, _, err := net.SplitHostPort(target.Value); err != nil {
+					v.errorf(target, "%s: %v", field, err)
+				}
+			}
+		}
+		if targets == 0 {
+			v.errorf(node, "wait_for has no target, expected one of %s", strings.Join(waitForTargets, ", "))
+		}
+		if options := mappingValue(node, "tls_options"); options != nil && mappingValue(node, "tls") == nil {
+			v.warnf(options, "tls_options are only used by tls, there is no tls target")
+		}
+	case reflect.TypeOf(ConnectConnector{}):
+		config, configFile := mappingValue(node, "config"), mappingValue(node, "config_file")
+		switch {
+		case config == nil && configFile == nil:
+			v.errorf(node, "connector is missing the config or config_file field")
+		case config != nil && configFile != nil:
+			v.errorf(configFile, "connector has both the config and config_file fields")
+		case configFile == nil && mappingValue(node, "name") == nil && mappingValue(config, "name") == nil:
+			v.errorf(node, "connector is missing the name field")
+		}
+	case reflect.TypeOf(SchemaRegistrySchema{}):
+		v.checkSubject(node)
+		schema, schemaFile := mappingValue(node, "schema"), mappingValue(node, "schema_file")
+		switch {
+		case schema == nil && schemaFile == nil:
+			v.errorf(node, "schema registry schema is missing the schema or schema_file field")
+		case schema != nil && schemaFile != nil:
+			v.errorf(schemaFile, "schema registry schema has both the schema and schema_file fields")
+		}
+		if t := mappingValue(node, "schema_type"); t != nil {
+			switch strings.ToUpper(t.Value) {
+			case "AVRO", "JSON", "PROTOBUF":
+			default:
+				v.errorf(t, "schema_type '%s', expected AVRO, JSON or PROTOBUF", t.Value)
+			}
+		}
+		v.checkSchemaVersion(mappingValue(node, "compatible_with"), "compatible_with")
+	case reflect.TypeOf(SchemaRegistryVersion{}):
+		v.checkSubject(node)
+		v.checkSchemaVersion(mappingValue(node, "version"), "version")
+	case reflect.TypeOf(KafkaCreateTopic{}), reflect.TypeOf(KafkaDeleteTopic{}), reflect.TypeOf(KafkaProduce{}):
+		v.checkKafkaTopic(node)
+	case reflect.TypeOf(KafkaConsume{}):
+		v.checkKafkaTopic(node)
+		if offset := mappingValue(node, "offset"); offset != nil {
+			if _, err := parseKafkaOffset(offset.Value); err != nil {
+				v.errorf(offset, "%v", err)
+			}
+		}
+		if partition := mappingValue(node, "partition"); partition != nil && mappingValue(node, "group") != nil {
+			v.errorf(partition, "a consumer group consumes all the partitions, it has no partition")
+		}
+	case reflect.TypeOf(KafkaRecordMatch{}):
+		v.checkRegex(mappingValue(node, "key"), "key")
+		v.checkRegex(mappingValue(node, "value"), "value")
+		if headers := mappingValue(node, "headers"); headers != nil {
+			for i := 1; i < len(headers.Content); i += 2 {
+				v.checkRegex(headers.Content[i], "headers")
+			}
+		}
+	case reflect.TypeOf(KafkaLag{}):
+		if group := mappingValue(node, "group"); group == nil || strings.TrimSpace(group.Value) == "" {
+			v.errorf(node, "kafka lag is missing the group field")
+		}
+	case reflect.TypeOf(ReadyProbe{}):
+		v.checkRegex(mappingValue(node, "stdout"), "ready stdout")
+	case reflect.TypeOf(OutFilter{}):
+		if !isTrue(mappingValue(node, "noregex")) && !isTrue(mappingValue(node, "partial")) {
+			v.checkRegex(mappingValue(node, "match"), "match")
+			v.checkRegex(mappingValue(node, "not_match"), "not_match")
+		}
+	case reflect.TypeOf(JSONAssertion{}):
+		v.checkRegex(mappingValue(node, "match"), "json match")
+		if path := mappingValue(node, "path"); path == nil {
+			v.errorf(node, "json assertion is missing the path field")
+		} else if _, err := parseJSONPath(path.Value); err != nil {
+			v.errorf(path, "%v", err)
+		}
+	case reflect.TypeOf(Register{}):
+		name := mappingValue(node, "name")
+		if name == nil {
+			v.errorf(node, "register is missing the name field")
+		} else if _, err := checkVarNames(map[string]string{name.Value: ""}); err != nil {
+			v.errorf(name, "register: %v", err)
+		}
+		v.checkRegex(mappingValue(node, "regex"), "register regex")
+		if from := mappingValue(node, "from"); from != nil && from.Value != "stdout" && from.Value != "stderr" {
+			v.errorf(from, "register from '%s', expected stdout or stderr", from.Value)
+		}
+		if scope := mappingValue(node, "scope"); scope != nil && scope.Value != "local" && scope.Value != "global" {
+			v.errorf(scope, "register scope '%s', expected local or global", scope.Value)
+		}
+	}
+}
+
+func mappingValueString(node *yamlv3.Node, key string) string {
+	if value := mappingValue(node, key); value != nil {
+		return value.Value
+	}
+	return ""
+}
+
+// checkVarRefs warns about the %NAME% references inside a group (or a context)
+// to variables that are not defined by it, by a register or globally.
+// They are only warnings as a command may contain percent signs, i.e `date +%Y%m%d`.
+func (v *validator) checkVarRefs(group *yamlv3.Node) {
+	defined := make(map[string]bool)
+	for name := range v.globalVars {
+		defined[name] = true
+	}
+	addMappingKeys(mappingValue(group, "vars"), defined)
+	addMappingKeys(mappingValue(group, "matrix"), defined)
+	if specs := mappingValue(group, "specs"); specs != nil {
+		for _, spec := range specs.Content {
+			addMappingKeys(mappingValue(spec, "vars"), defined)
+			addMappingKeys(mappingValue(spec, "matrix"), defined)
+		}
+	}
+	collectRegisters(group, defined)
+
+	var scan func(node *yamlv3.Node)
+	scan = func(node *yamlv3.Node) {
+		if node.Kind == yamlv3.ScalarNode {
+			for _, ref := range varRefRegexp.FindAllString(node.Value, -1) {
+				name := strings.Trim(ref, "%")
+				if name == "UNIQUE" || uniqRegexp.MatchString(ref) || defined[name] {
+					continue
+				}
+				v.warnf(node, "variable '%s' is not defined", ref)
+			}
+			return
+		}
+		for _, child := range node.Content {
+			scan(child)
+		}
+	}
+
+	for i := 0; i+1 < len(group.Content); i += 2 {
+		if key := group.Content[i].Value; key != "vars" && key != "constants" {
+			scan(group.Content[i+1])
+		}
+	}
+}
+
+// groupNode is a group of a validated file, with its name as it runs.
+type groupNode struct {
+	file string
+	name string
+	// prefix is the prefix of the names of the specs of its context, they depend on each other by their own names.
+	prefix    string
+	dependsOn *yamlv3.Node
+}
+
+// collectGroups appends the groups of the document "root" of the "file" to the "groups".
+func collectGroups(file string, root *yamlv3.Node, groups []groupNode) []groupNode {
+	switch root.Kind {
+	case yamlv3.SequenceNode:
+		for _, group := range root.Content {
+			groups = append(groups, groupNode{file: file, name: mappingValueString(group, "name"), dependsOn: mappingValue(group, "depends_on")})
+		}
+	case yamlv3.MappingNode:
+		if specs := mappingValue(root, "specs"); specs != nil {
+			prefix := mappingValueString(root, "describe") + " | "
+			for _, spec := range specs.Content {
+				groups = append(groups, groupNode{file: file, name: prefix + mappingValueString(spec, "name"), prefix: prefix,
+					dependsOn: mappingValue(spec, "depends_on")})
+			}
+		}
+	}
+	return groups
+}
+
+// checkDependencies returns the dependencies of the "groups" on groups that do not exist,
+// or if all of them exist, the groups that depend on each other.
+func checkDependencies(groups []groupNode) []ValidationIssue {
+	names := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		names[g.name] = true
+	}
+
+	var (
+		issues    []ValidationIssue
+		entries   []EntryGroup
+		dependsOn = make(map[string]*groupNode) // the first group with the name that has dependencies.
+	)
+	for i, g := range groups {
+		group := EntryGroup{Name: g.name}
+		if g.dependsOn != nil {
+			for _, dep := range g.dependsOn.Content {
+				name := dep.Value
+				if g.prefix != "" && names[g.prefix+name] {
+					name = g.prefix + name
+				}
+				if !names[name] {
+					issues = append(issues, ValidationIssue{File: g.file, Line: dep.Line,
+						Message: fmt.Sprintf("group '%s' depends on group '%s' which does not exist", g.name, dep.Value)})
+				}
+				group.DependsOn = append(group.DependsOn, name)
+			}
+			if dependsOn[g.name] == nil {
+				dependsOn[g.name] = &groups[i]
+			}
+		}
+		mergeEntryGroups(&entries, []EntryGroup{group})
+	}
+	if len(issues) > 0 {
+		return issues
+	}
+
+	if _, err := dependencyOrder(entries); err != nil {
+		if cycle, ok := err.(dependencyCycleError); ok {
+			g := dependsOn[cycle[0]]
+			issues = append(issues, ValidationIssue{File: g.file, Line: g.dependsOn.Line, Message: err.Error()})
+		}
+	}
+	return issues
+}
+
+// collectRegisters adds the names of all the registers and of the foreach vars under "node" to "vars".
+func collectRegisters(node *yamlv3.Node, vars map[string]bool) {
+	addMappingKeys(mappingValue(node, "foreach"), vars)
+	if register := mappingValue(node, "register"); register != nil {
+		for _, r := range register.Content {
+			if name := mappingValue(r, "name"); name != nil {
+				vars[name.Value] = true
+			}
+		}
+	}
+	for _, child := range node.Content {
+		collectRegisters(child, vars)
+	}
+}
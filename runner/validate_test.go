@@ -0,0 +1,185 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	groups := filepath.Join(dir, "groups.yml")
+	if err := ioutil.WriteFile(groups, []byte(`- name: coyote
+  vars:
+    HOST: localhost
+
+- name: Brokers
+  vars:
+    bad-name: x
+  entries:
+    - name: typo
+      command: echo %HOST% %TOPIC%
+      stdout_hass: [ "x" ]
+    - name: no unit
+      command: echo
+      timeout: 30
+    - name: missing command
+      stdout_has: [ "(" ]
+    - name: codes
+      command: "false"
+      exit_code: one
+      signal: SIGNOPE
+      stdout:
+        - match: [ "[" ]
+          json:
+            - path: $.a
+              equals: 1
+              eqals: 2
+      register:
+        - name: ID
+          from: stdin
+      max_output: 1TB
+    - name: stopper
+      stop: server
+      command: echo
+
+- name: Topics
+  on_failure: stop
+  depends_on: [ Brokers, Missing ]
+  entries:
+    - command: echo %TOPIC%
+      foreach: { TOPIC: [] }
+    - name: request
+      http:
+        method: GET
+      command: echo
+    - name: kafka
+      kafka:
+        security_protocol: SSL_PLAIN
+        create_topic: { partitions: 3 }
+        consume: { topic: t, offset: first, partition: 0, group: g, expect: [ { value: "(" } ] }
+    - name: registry
+      schema_registry:
+        register: { subject: users-value, schema_type: XML, compatible_with: newest }
+        fetch: { version: 0 }
+    - name: connector
+      connect:
+        url: http://localhost:8083
+        create: { config: { topics: t } }
+        delete: sink
+        state: STARTED
+    - name: wait
+      wait_for:
+        tls_options: { insecure_skip_verify: true }
+        interval: soon
+    - name: port
+      wait_for: { tcp: localhost, dns: "%HOST%" }
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	context := filepath.Join(dir, "context.yml")
+	if err := ioutil.WriteFile(context, []byte(`describe: Tests
+constants:
+  TEST_VAR: test
+before_eahc:
+  - command: echo
+specs:
+  - name: First
+    entries:
+      - command: echo %TEST_VAR% %ID%
+        sleep_after: 1 second
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, issue := range Validate([]string{context, groups}) {
+		got = append(got, strings.TrimPrefix(issue.String(), dir+string(filepath.Separator)))
+	}
+
+	expected := []string{
+		"context.yml:4: error: unknown field 'before_eahc' in Context",
+		"context.yml:9: warning: variable '%ID%' is not defined", // registered locally by another file.
+		"context.yml:10: error: bad duration: time: unknown unit \" second\" in duration \"1 second\"",
+		"groups.yml:7: error: Variable name 'bad-name' contains illegal characters. Only alphanumerics and underscore are permitted for var names.",
+		"groups.yml:10: warning: variable '%TOPIC%' is not defined",
+		"groups.yml:11: error: unknown field 'stdout_hass' in Entry",
+		"groups.yml:14: error: duration '30' has no unit, it means 30ns, use e.g '30s'",
+		"groups.yml:15: error: entry 'missing command' is missing the command field",
+		"groups.yml:16: error: stdout_has: bad regexp: error parsing regexp: missing closing ): `(`",
+		"groups.yml:19: error: bad exit_code 'one', expected a number optionally prefixed with '!'",
+		"groups.yml:20: error: unknown signal 'SIGNOPE'",
+		"groups.yml:22: error: match: bad regexp: error parsing regexp: missing closing ]: `[`",
+		"groups.yml:26: error: unknown field 'eqals' in JSONAssertion",
+		"groups.yml:29: error: register from 'stdin', expected stdout or stderr",
+		"groups.yml:30: error: bad size '1TB', expected a number of bytes optionally followed by KB, MB or GB",
+		"groups.yml:33: error: entry 'stopper' stops a background entry, it has no command",
+		"groups.yml:36: error: on_failure 'stop', expected continue, skip_rest or abort",
+		"groups.yml:37: error: group 'Topics' depends on group 'Missing' which does not exist",
+		"groups.yml:40: warning: foreach 'TOPIC' has no values, nothing runs",
+		"groups.yml:43: error: http request is missing the url field",
+		"groups.yml:44: error: entry 'request' runs the http step, it has no command",
+		"groups.yml:47: error: kafka step is missing the brokers field",
+		"groups.yml:47: error: security_protocol 'SSL_PLAIN', expected one of PLAINTEXT, SSL, SASL_PLAINTEXT, SASL_SSL",
+		"groups.yml:48: error: kafka action is missing the topic field",
+		"groups.yml:49: error: value: bad regexp: error parsing regexp: missing closing ): `(`",
+		"groups.yml:49: error: offset 'first' is not earliest, latest or an offset",
+		"groups.yml:49: error: a consumer group consumes all the partitions, it has no partition",
+		"groups.yml:49: error: kafka step has more than one action: create_topic, consume",
+		"groups.yml:52: error: schema registry schema is missing the schema or schema_file field",
+		"groups.yml:52: error: schema_type 'XML', expected AVRO, JSON or PROTOBUF",
+		"groups.yml:52: error: compatible_with 'newest', expected latest or a version number",
+		"groups.yml:52: error: schema registry step is missing the url field",
+		"groups.yml:53: error: schema registry action is missing the subject field",
+		"groups.yml:53: error: version '0', expected latest or a version number",
+		"groups.yml:53: error: schema registry step has more than one action: register, fetch",
+		"groups.yml:57: error: connector is missing the name field",
+		"groups.yml:58: error: connect step has more than one action: create, delete",
+		"groups.yml:59: error: state 'STARTED', expected one of RUNNING, PAUSED, FAILED, UNASSIGNED, RESTARTING",
+		"groups.yml:62: error: wait_for has no target, expected one of tcp, tls, unix, dns, file",
+		"groups.yml:62: warning: tls_options are only used by tls, there is no tls target",
+		"groups.yml:63: error: bad duration: time: invalid duration \"soon\"",
+		"groups.yml:65: error: tcp: address localhost: missing port in address",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected issues:\n%s\n\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	cycle := filepath.Join(dir, "cycle.yml")
+	if err := ioutil.WriteFile(cycle, []byte(`describe: Tests
+specs:
+  - name: First
+    depends_on: [ Second ]
+    entries:
+      - command: echo
+  - name: Second
+    depends_on: [ First ]
+    entries:
+      - command: echo
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	issues := Validate([]string{cycle})
+	if expected := "cycle.yml:4: error: groups depend on each other: Tests | First -> Tests | Second -> Tests | First"; len(issues) != 1 ||
+		strings.TrimPrefix(issues[0].String(), dir+string(filepath.Separator)) != expected {
+		t.Fatalf("expected the issue '%s' but got %v", expected, issues)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WaitFor waits until its targets are ready instead of running a command, i.e until a port accepts connections.
+// All of its targets should be ready, the time it took is the `ReadyTime` of the result of the entry.
+type WaitFor struct {
+	// TCP is an address that should accept connections, i.e `localhost:9092`.
+	TCP string `yaml:"tcp,omitempty"`
+	// TLS is an address that should complete a TLS handshake, verified with the `TLSOptions`.
+	TLS        string      `yaml:"tls,omitempty"`
+	TLSOptions *TLSOptions `yaml:"tls_options,omitempty"`
+	// Unix is the path of a unix socket that should exist.
+	Unix string `yaml:"unix,omitempty"`
+	// DNS is a host name that should resolve.
+	DNS string `yaml:"dns,omitempty"`
+	// File is a file that should exist, relative to the `WorkDir` of the entry.
+	File string `yaml:"file,omitempty"`
+
+	// Timeout fails the step if the targets are not ready in time, otherwise it waits until the timeout of the entry.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Interval is the wait between two checks of the targets, defaults to 250 milliseconds.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// waitForTargets are the yaml fields of the targets of a `WaitFor`.
+var waitForTargets = []string{"tcp", "tls", "unix", "dns", "file"}
+
+// targets returns the kinds and the targets that are set, in the order of the `waitForTargets`.
+func (w *WaitFor) targets() (kinds, targets []string) {
+	for i, target := range []string{w.TCP, w.TLS, w.Unix, w.DNS, w.File} {
+		if target != "" {
+			kinds = append(kinds, waitForTargets[i])
+			targets = append(targets, target)
+		}
+	}
+	return kinds, targets
+}
+
+// String describes the targets, i.e `wait for tcp localhost:9092, file /tmp/ready`.
+func (w *WaitFor) String() string {
+	kinds, targets := w.targets()
+	for i := range kinds {
+		targets[i] = kinds[i] + " " + targets[i]
+	}
+	return "wait for " + strings.Join(targets, ", ")
+}
+
+// run checks the targets every `Interval` until they are all ready, then writes how long it took to "stderr".
+// It fails with the first target that is not ready once the `Timeout` passed.
+func (w *WaitFor) run(ctx context.Context, v Entry, stdout, stderr io.Writer) error {
+	if kinds, _ := w.targets(); len(kinds) == 0 {
+		return fmt.Errorf("wait_for has no target, expected one of %s", strings.Join(waitForTargets, ", "))
+	}
+
+	var tlsConfig *tls.Config
+	if w.TLSOptions != nil {
+		var err error
+		if tlsConfig, err = w.TLSOptions.config(v.WorkDir); err != nil {
+			return err
+		}
+	}
+
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultReadyInterval
+	}
+
+	start := time.Now()
+	for checks := 1; ; checks++ {
+		err := w.check(ctx, v.WorkDir, tlsConfig)
+		if err == nil {
+			fmt.Fprintf(stderr, "ready after %s, %d checks\n", time.Since(start).Round(time.Millisecond), checks)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(stderr, "not ready after %s, %d checks: %v\n", time.Since(start).Round(time.Millisecond), checks, err)
+			return fmt.Errorf("not ready after %s: %v", time.Since(start).Round(time.Millisecond), err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// check returns the error of the first target that is not ready.
+func (w *WaitFor) check(ctx context.Context, workDir string, tlsConfig *tls.Config) error {
+	if w.TCP != "" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", w.TCP)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+
+	if w.TLS != "" {
+		d := tls.Dialer{Config: tlsConfig}
+		conn, err := d.DialContext(ctx, "tcp", w.TLS)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+
+	if w.Unix != "" {
+		info, err := os.Stat(w.Unix)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("'%s' is not a unix socket", w.Unix)
+		}
+	}
+
+	if w.DNS != "" {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, w.DNS)
+		if err != nil {
+			return err
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("lookup %s: no addresses", w.DNS)
+		}
+	}
+
+	if w.File != "" {
+		file := w.File
+		if workDir != "" && !filepath.IsAbs(file) {
+			file = filepath.Join(workDir, file)
+		}
+		if _, err := os.Stat(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mapVars returns the step with the local and global vars mapped to its targets.
+func (w *WaitFor) mapVars(localVars, globalVars map[string]string) *WaitFor {
+	if w == nil {
+		return nil
+	}
+
+	mapped := *w
+	mapped.TCP = replaceVars(w.TCP, localVars, globalVars)
+	mapped.TLS = replaceVars(w.TLS, localVars, globalVars)
+	mapped.TLSOptions = w.TLSOptions.mapVars(localVars, globalVars)
+	mapped.Unix = replaceVars(w.Unix, localVars, globalVars)
+	mapped.DNS = replaceVars(w.DNS, localVars, globalVars)
+	mapped.File = replaceVars(w.File, localVars, globalVars)
+	return &mapped
+}
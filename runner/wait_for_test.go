@@ -0,0 +1,186 @@
+// Copyright 2016-2021, Lenses.io Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunWaitFor(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// A port that accepts no connections.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(filepath.Join(dir, "ca.pem"), ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "coyote.sock")
+	unix, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	defer unix.Close()
+
+	// The file is created while its entry waits for it.
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		ioutil.WriteFile(filepath.Join(dir, "ready"), nil, 0644)
+	}()
+
+	yamlContents := []byte(fmt.Sprintf(`
+- name: Wait For
+  vars:
+    PORT: %d
+  entries:
+    - name: File
+      workdir: %s
+      wait_for:
+        file: ready
+        interval: 10ms
+    - name: TCP
+      wait_for: { tcp: "127.0.0.1:%%PORT%%" }
+    - name: TLS
+      workdir: %s
+      wait_for:
+        tls: %s
+        tls_options: { ca_cert: ca.pem }
+    - name: Unix
+      wait_for: { unix: %s, dns: localhost }
+    - name: Not a socket
+      workdir: %s
+      wait_for: { unix: %s }
+      timeout: 100ms
+    - name: Closed
+      wait_for:
+        tcp: %s
+        timeout: 100ms
+        interval: 10ms
+    - name: Untrusted
+      wait_for:
+        tls: %s
+        timeout: 100ms`,
+		listener.Addr().(*net.TCPAddr).Port, dir, dir, srv.Listener.Addr(), socket,
+		dir, filepath.Join(dir, "ca.pem"), closedAddr, srv.Listener.Addr()))
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ status, exit string }{
+		{"ok", "0"},
+		{"ok", "0"},
+		{"ok", "0"},
+		{"ok", "0"},
+		{"timeout", "(timeout) not ready after "},
+		{"error", "not ready after "},
+		{"error", "not ready after "},
+	}
+	results := data.Results[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results but got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i].Status != e.status || !strings.HasPrefix(results[i].Exit, e.exit) {
+			t.Fatalf("[%d] expected status '%s' and exit '%s' but got '%s' and '%s': %s", i, e.status, e.exit,
+				results[i].Status, results[i].Exit, strings.Join(results[i].Stderr, "\n"))
+		}
+	}
+
+	if ready := results[0].ReadyTime; ready < 0.05 {
+		t.Fatalf("expected to wait for the file but got %gs", ready)
+	}
+	if ready := results[5].ReadyTime; ready != 0 {
+		t.Fatalf("expected no ready time for a failed wait but got %gs", ready)
+	}
+	if exit := results[4].Exit; !strings.HasSuffix(exit, "is not a unix socket") {
+		t.Fatalf("expected a file to not be a socket but got '%s'", exit)
+	}
+	if exit := results[5].Exit; !strings.Contains(exit, "connection refused") {
+		t.Fatalf("expected the connection to be refused but got '%s'", exit)
+	}
+	if command := results[3].Command; command != "wait for unix "+socket+", dns localhost" {
+		t.Fatalf("expected the step to be described as a command but got '%s'", command)
+	}
+}
+
+func TestRunWaitForRetries(t *testing.T) {
+	dir := t.TempDir()
+	// The file is created after the first attempts of its entry timed out.
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		ioutil.WriteFile(filepath.Join(dir, "ready"), nil, 0644)
+	}()
+
+	yamlContents := []byte(fmt.Sprintf(`
+- name: Wait For
+  entries:
+    - name: File
+      workdir: %s
+      retries: 20
+      retry_interval: 50ms
+      wait_for:
+        file: ready
+        timeout: 50ms
+        interval: 10ms`, dir))
+
+	var groups []EntryGroup
+	if err := TextEntryGroupLoader(yamlContents).Load(&groups); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Run(context.Background(), groups, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := data.Results[0].Results[0]
+	if result.Status != "ok" || len(result.Attempts) < 2 {
+		t.Fatalf("expected the entry to be ready after a few attempts but got '%s' after %d", result.Status, len(result.Attempts))
+	}
+	if ready := result.ReadyTime; ready < 0.25 {
+		t.Fatalf("expected the ready time to count all the attempts but got %gs", ready)
+	}
+}
@@ -16,25 +16,43 @@ package main
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 )
 
 var (
 	files = map[string]string{
 		"mainTemplate": "template.html",
 	}
-	outFile = "template_autogenerated.go"
+	outFile = "runner/template_autogenerated.go"
+
+	// the scripts and stylesheets of the templates to include in the self-contained report.
+	assetRegexp = regexp.MustCompile(`<(?:script|link rel="stylesheet")[^>]* (?:src|href)="(//[^"]+\.(?:js|css))"`)
+	assetsDir   = "runner/assets"
 )
 
 // Read all files and save them as strings literals in wordlists.go
 func main() {
+	includeTemplates()
+
+	if missing := includeAssets(); missing > 0 {
+		fmt.Printf("%d assets were not included, the report needs network access to load them\n", missing)
+		os.Exit(1)
+	}
+}
+
+func includeTemplates() {
 	out, err := os.Create(outFile)
 	if err != nil {
 		fmt.Println(err)
 	}
 	defer out.Close()
 
-	out.Write([]byte("package main\n\nconst (\n"))
+	out.Write([]byte("package runner\n\nconst (\n"))
 
 	for k, v := range files {
 		out.Write([]byte(k + " = `"))
@@ -48,3 +66,54 @@ func main() {
 	}
 	out.Write([]byte(")\n"))
 }
+
+// includeAssets downloads the assets of the templates that are missing from the assets directory,
+// under their urls, i.e `runner/assets/ajax.googleapis.com/ajax/libs/angularjs/1.5.5/angular.min.js`.
+// The directory is committed and embedded in the runner, so the report renders without network access.
+// It returns the number of assets that could not be downloaded.
+func includeAssets() (missing int) {
+	for _, v := range files {
+		b, err := ioutil.ReadFile(v)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		for _, match := range assetRegexp.FindAllStringSubmatch(string(b), -1) {
+			url := match[1]
+			file := filepath.Join(assetsDir, filepath.FromSlash(strings.TrimPrefix(url, "//")))
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				if err = downloadAsset("https:"+url, file); err != nil {
+					fmt.Printf("asset %s was not included: %v\n", url, err)
+					missing++
+				}
+			}
+		}
+	}
+	return missing
+}
+
+func downloadAsset(url, file string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, resp.Body)
+	return err
+}
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -8,7 +10,7 @@ import (
 
 func main() {
 	versiongen.DirtyString = "+"
-	versiongen.IgnoreFiles = []string{"version.go", "template_autogenerated.go"}
+	versiongen.IgnoreFiles = []string{"version.go", "runner/template_autogenerated.go"}
 	err := versiongen.Create()
 	if err != nil {
 		log.Fatalln(err)